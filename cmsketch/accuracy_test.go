@@ -0,0 +1,64 @@
+package cmsketch
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// accuracy adds counts to cm and returns the fraction of items whose estimate
+// misses by more than cm's ErrorBound, measured against the stream's total, or
+// for a CountSketch the square root of its sum of squared counts
+func accuracy(cm CMSketch, counts map[string]uint64) float64 {
+	var total, squares float64
+	for key, count := range counts {
+		cm.Add([]byte(key), count)
+		total += float64(count)
+		squares += float64(count) * float64(count)
+	}
+
+	norm := total
+	if sketch, ok := cm.(*cmsketch); ok && sketch.estimator == CountSketch {
+		norm = math.Sqrt(squares)
+	}
+	bound := cm.ErrorBound() * norm
+
+	misses := 0
+	for key, count := range counts {
+		if math.Abs(float64(cm.Count([]byte(key)))-float64(count)) > bound {
+			misses++
+		}
+	}
+	return float64(misses) / float64(len(counts))
+}
+
+func TestAccuracy(t *testing.T) {
+	fmt.Println("TestAccuracy")
+	counts := zipf(200000, 20000)
+	estimators := map[string]func(float64, float64, ...Option) (CMSketch, error){
+		"count-min":      New,
+		"count-mean-min": NewCountMeanMin,
+		"count-sketch":   NewCountSketch,
+	}
+	cases := []struct {
+		delta, epsilon float64
+	}{
+		{0.9, 0.01},
+		{0.99, 0.005},
+		{0.999, 0.001},
+	}
+
+	for name, create := range estimators {
+		for _, c := range cases {
+			cm, err := create(c.delta, c.epsilon)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", name, err)
+			}
+			missed := accuracy(cm, counts)
+			t.Logf("%s delta:%g epsilon:%g depth:%d width:%d missed:%.5f allowed:%.5f", name, c.delta, c.epsilon, cm.Depth(), cm.Width(), missed, 1-cm.Confidence())
+			if missed > 1-cm.Confidence() {
+				t.Errorf("%s delta:%g epsilon:%g missed the error bound for %.5f of items, more than the %.5f allowed", name, c.delta, c.epsilon, missed, 1-cm.Confidence())
+			}
+		}
+	}
+}
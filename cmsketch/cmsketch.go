@@ -1,10 +1,10 @@
 package cmsketch
 
 import (
-	"encoding/binary"
 	"errors"
-	"hash/fnv"
 	"math"
+	"math/rand/v2"
+	"slices"
 	"sync"
 )
 
@@ -15,101 +15,273 @@ type CMSketch interface {
 	Remove(item []byte, total uint64) error
 	Count(item []byte) uint64
 	Merge(merge CMSketch) error
+	InnerProduct(other CMSketch) (uint64, error)
 	Width() uint
 	Depth() uint
 	Size() uint
-	data(x, y int) uint64
+	MemoryUsage() uint64
+	ErrorBound() float64
+	Confidence() float64
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+	MarshalJSON() ([]byte, error)
+	snapshot() *cmsketch
 }
 
 // implementation struct for CMSketch
 type cmsketch struct {
-	d, w  uint
-	grid  [][]uint64
-	h     hasher
+	d, w uint
+	// cells packs the d*w counters row by row, 64/bits of them to a word
+	cells  []uint64
+	bits   uint
+	morris float64
+	rng    *rand.Rand
+	family HashFamily
+	seed   uint64
+	h      hashFunc
+	// conservative update only raises counters as far as the item's new estimate
+	conservative bool
+	estimator    Estimator
+	// total of every count added, only kept for CountMeanMin which uses it to estimate the noise in a row
+	total uint64
 	mutex sync.RWMutex
 }
 
-type hasher func(item []byte) []uint
+// config is what two sketches must share to be merged
+type config struct {
+	family       HashFamily
+	seed         uint64
+	estimator    Estimator
+	conservative bool
+	bits         uint
+	morris       float64
+}
+
+// Option configures a CMSketch when it's created with New
+type Option func(*cmsketch)
+
+// WithHash sets the hash family used to place items, the default is FNV
+func WithHash(family HashFamily) Option {
+	return func(cms *cmsketch) {
+		cms.family = family
+	}
+}
+
+// WithConservativeUpdate makes Add raise each of an item's counters only as far
+// as its new minimum estimate requires, instead of incrementing all of them. It
+// reduces the overestimates of skewed streams, but the counters no longer hold
+// enough to undo an Add so Remove returns ErrConservativeRemove.
+func WithConservativeUpdate() Option {
+	return func(cms *cmsketch) {
+		cms.conservative = true
+	}
+}
+
+// WithSeed sets the seed given to the hash family, the default is 0
+func WithSeed(seed uint64) Option {
+	return func(cms *cmsketch) {
+		cms.seed = seed
+	}
+}
 
 var (
 	// ErrCannotMergeDifferentDimensions when CMSketch.Merge is invoked with another CMSketch with different dimensions
 	ErrCannotMergeDifferentDimensions = errors.New("cannot merge CMSketch objects with different dimensions")
+	// ErrCannotMergeDifferentHashes when CMSketch.Merge is invoked with another CMSketch using a different hash family or seed
+	ErrCannotMergeDifferentHashes = errors.New("cannot merge CMSketch objects with different hash families or seeds")
+	// ErrUnknownHashFamily when New is given a HashFamily this package doesn't implement
+	ErrUnknownHashFamily = errors.New("unknown hash family")
+	// ErrCannotMergeDifferentModes when CMSketch.Merge is invoked with one conservative update CMSketch and one standard one
+	ErrCannotMergeDifferentModes = errors.New("cannot merge conservative update and standard CMSketch objects")
+	// ErrConservativeRemove when CMSketch.Remove is invoked on a conservative update CMSketch
+	ErrConservativeRemove = errors.New("cannot remove from a conservative update CMSketch")
+	// ErrCannotMergeDifferentEstimators when CMSketch.Merge is invoked with another CMSketch using a different Estimator
+	ErrCannotMergeDifferentEstimators = errors.New("cannot merge CMSketch objects with different estimators")
+	// ErrConservativeEstimator when conservative update is used with an Estimator other than CountMin
+	ErrConservativeEstimator = errors.New("conservative update is only supported by the CountMin estimator")
+	// ErrOverflow when CMSketch.Add or CMSketch.Merge would overflow a counter
+	ErrOverflow = errors.New("CMSketch counter overflow")
+	// ErrUnderflow when CMSketch.Remove drops more of an item than can have been added
+	ErrUnderflow = errors.New("CMSketch counter underflow")
+	// ErrInvalidDelta when New is given a delta that isn't strictly between 0 and 1
+	ErrInvalidDelta = errors.New("delta must be greater than 0 and less than 1")
+	// ErrInvalidEpsilon when New is given an epsilon that isn't greater than 0
+	ErrInvalidEpsilon = errors.New("epsilon must be greater than 0")
+	// ErrInvalidDimensions when a sketch would have no counters, or too many to address
+	ErrInvalidDimensions = errors.New("depth and width must be at least 1 and their product must fit in an int")
 )
 
-// New returns a new CountMin Sketch
-func New(delta, epsilon float64) (CMSketch, error) {
-	cm := &cmsketch{
-		d: depth(delta),
-		w: width(epsilon),
-	}
+// New returns a new CountMin Sketch. Its estimates exceed the true count by at
+// most epsilon times the total of every count added, with probability delta.
+// delta must be in (0, 1) and epsilon greater than 0.
+func New(delta, epsilon float64, opts ...Option) (CMSketch, error) {
+	return newSketch(CountMin, delta, epsilon, opts)
+}
+
+// NewWithDimensions returns a new CountMin Sketch with exactly depth rows of
+// width counters, ErrorBound and Confidence report the guarantee they give
+func NewWithDimensions(depth, width uint, opts ...Option) (CMSketch, error) {
+	return buildSketch(CountMin, depth, width, opts)
+}
 
-	cm.grid = make([][]uint64, cm.d)
-	for i := 0; uint(i) < cm.d; i++ {
-		cm.grid[i] = make([]uint64, cm.w)
+func newSketch(estimator Estimator, delta, epsilon float64, opts []Option) (*cmsketch, error) {
+	if !(delta > 0 && delta < 1) {
+		return nil, ErrInvalidDelta
+	}
+	if !(epsilon > 0) || math.IsInf(epsilon, 0) {
+		return nil, ErrInvalidEpsilon
+	}
+	w := math.Ceil(math.E / epsilon)
+	if w > math.MaxInt {
+		return nil, ErrInvalidDimensions
 	}
+	return buildSketch(estimator, depth(delta), uint(w), opts)
+}
 
-	cm.h = newHasher(cm.d, cm.w)
+func buildSketch(estimator Estimator, d, w uint, opts []Option) (*cmsketch, error) {
+	if d == 0 || w == 0 || d > math.MaxInt/w {
+		return nil, ErrInvalidDimensions
+	}
 
-	return cm, nil
-}
+	cm := &cmsketch{
+		d:         d,
+		w:         w,
+		family:    FNV,
+		estimator: estimator,
+		bits:      64,
+	}
+	for _, opt := range opts {
+		opt(cm)
+	}
 
-func newHasher(d, w uint) hasher {
-	h := fnv.New64()
-	return func(item []byte) []uint {
-		defer h.Reset()
-		h.Write(item)
+	h, ok := cm.family.hashFunc()
+	if !ok {
+		return nil, ErrUnknownHashFamily
+	}
+	cm.h = h
+	if cm.conservative && cm.estimator != CountMin {
+		return nil, ErrConservativeEstimator
+	}
 
-		u, l := upperAndLower(h.Sum(nil))
-		positions := make([]uint, d)
-		for i := uint(0); i < d; i++ {
-			position := (u*i + l) % w
-			positions[i] = position
-		}
-		return positions
+	if err := cm.validateCounters(); err != nil {
+		return nil, err
 	}
+	return cm, nil
 }
 
-func upperAndLower(hashed []byte) (uint, uint) {
-	u := binary.BigEndian.Uint32(hashed[0:4])
-	l := binary.BigEndian.Uint32(hashed[4:8])
-	return uint(u), uint(l)
+// calculates the depth of the sketch's grid, ln(1/(1-delta)) rows make every
+// row overestimate by more than the error bound with probability at most 1-delta
+func depth(delta float64) uint {
+	r := math.Log(1 / (1 - delta))
+	return uint(math.Ceil(r))
 }
 
-// calculates the width of the sketch's grid
-func width(episilon float64) uint {
-	r := math.E / episilon
-	return uint(math.Ceil(r))
+// ErrorBound is epsilon, the fraction of the total count an estimate can exceed
+// the true count by. For a CountSketch the error is relative to the square root
+// of the sum of squared counts rather than the total, and can go either way.
+func (cms *cmsketch) ErrorBound() float64 {
+	if cms.estimator == CountSketch {
+		return math.Sqrt(3 / float64(cms.w))
+	}
+	return math.E / float64(cms.w)
 }
 
-// calculates the depth of the sketch's grid
-func depth(delta float64) uint {
-	r := math.Log(1-delta) / math.Log(0.5)
-	return uint(math.Ceil(r))
+// Confidence is the probability an estimate is within ErrorBound
+func (cms *cmsketch) Confidence() float64 {
+	if cms.estimator == CountSketch {
+		// each row is within the bound with probability 2/3, by Hoeffding's
+		// inequality their median is unless a third of them miss
+		return 1 - math.Exp(-float64(cms.d)/18)
+	}
+	return 1 - math.Exp(-float64(cms.d))
 }
 
-// Add places an item into the data structure
+// Add places an item into the data structure. If any of the item's counters
+// would overflow it returns ErrOverflow and leaves the sketch unchanged.
 func (cms *cmsketch) Add(item []byte, count uint64) error {
 	cms.lock(true)
 	defer cms.unlock(true)
 
 	ls := cms.getLocations(item)
-	for i := uint(0); i < cms.Depth(); i++ {
-		y := ls[i]
-		cms.grid[i][y] += count
+	if cms.estimator == CountSketch {
+		return cms.addSigned(ls, count, 1)
+	}
+	if cms.conservative {
+		return cms.addConservative(ls, count)
+	}
+	if !cms.exact() {
+		cms.addApproximate(ls, count)
+		return nil
+	}
+
+	if cms.estimator == CountMeanMin && cms.total > math.MaxUint64-count {
+		return ErrOverflow
+	}
+	for i := uint(0); i < cms.d; i++ {
+		if cms.raw(i, ls.column(i)) > math.MaxUint64-count {
+			return ErrOverflow
+		}
+	}
+	for i := uint(0); i < cms.d; i++ {
+		y := ls.column(i)
+		cms.setRaw(i, y, cms.raw(i, y)+count)
+	}
+	if cms.estimator == CountMeanMin {
+		cms.total += count
+	}
+
+	return nil
+}
+
+func (cms *cmsketch) addConservative(ls locations, count uint64) error {
+	estimate := cms.estimate(ls)
+	if estimate > math.MaxUint64-count {
+		if cms.exact() {
+			return ErrOverflow
+		}
+		count = math.MaxUint64 - estimate
 	}
 
+	target, draw := estimate+count, cms.draw()
+	for i := uint(0); i < cms.d; i++ {
+		y := ls.column(i)
+		if cms.value(i, y) < target {
+			cms.store(i, y, target, draw)
+		}
+	}
 	return nil
 }
 
-// Remove drops the count of an item, if possible
+// Remove drops the count of an item. Every counter of an item is at least its
+// true count, so if any is smaller than count the item can't have been added
+// that many times, it returns ErrUnderflow and leaves the sketch unchanged.
 func (cms *cmsketch) Remove(item []byte, count uint64) error {
 	cms.lock(true)
 	defer cms.unlock(true)
 
+	if cms.conservative {
+		return ErrConservativeRemove
+	}
+
 	ls := cms.getLocations(item)
-	for i := uint(0); i < cms.Depth(); i++ {
-		y := ls[i]
-		cms.grid[i][y] -= count
+	if cms.estimator == CountSketch {
+		return cms.addSigned(ls, count, -1)
+	}
+	if !cms.exact() {
+		return cms.removeApproximate(ls, count)
+	}
+
+	for i := uint(0); i < cms.d; i++ {
+		if cms.raw(i, ls.column(i)) < count {
+			return ErrUnderflow
+		}
+	}
+	for i := uint(0); i < cms.d; i++ {
+		y := ls.column(i)
+		cms.setRaw(i, y, cms.raw(i, y)-count)
+	}
+	if cms.estimator == CountMeanMin {
+		cms.total -= count
 	}
 
 	return nil
@@ -120,35 +292,112 @@ func (cms *cmsketch) Count(item []byte) uint64 {
 	cms.lock(false)
 	defer cms.unlock(false)
 
-	var min uint64
-	for x, y := range cms.getLocations(item) {
-		if min == 0 || cms.grid[x][y] < min {
-			min = cms.grid[x][y]
-		}
+	ls := cms.getLocations(item)
+	switch cms.estimator {
+	case CountSketch:
+		return cms.countSketch(ls)
+	case CountMeanMin:
+		return cms.countMeanMin(ls)
 	}
 
+	return cms.estimate(ls)
+}
+
+// estimate is the smallest of the item's counters, callers must hold the lock
+func (cms *cmsketch) estimate(ls locations) uint64 {
+	min := uint64(math.MaxUint64)
+	for x := uint(0); x < cms.d; x++ {
+		if v := cms.value(x, ls.column(x)); v < min {
+			min = v
+		}
+	}
 	return min
 }
 
 // Merge combines two CMSketch stuctures, if they're equivalently sized
 // If they're not equivalently sized, returns ErrCannotMergeDifferentDimensions
+// If they don't hash the same way, returns ErrCannotMergeDifferentHashes
+// If they use different estimators, returns ErrCannotMergeDifferentEstimators
+// If only one uses conservative update, returns ErrCannotMergeDifferentModes
+// If their counters have different widths or counting, returns ErrCannotMergeDifferentCounters
+// If any counter would overflow, returns ErrOverflow and leaves the sketch unchanged
 func (cms *cmsketch) Merge(merge CMSketch) error {
+	return cms.merge(merge.snapshot())
+}
+
+// merge adds other's counters to cms, other must not be shared with anyone else
+func (cms *cmsketch) merge(other *cmsketch) error {
 	cms.lock(true)
 	defer cms.unlock(true)
 
-	if cms.Depth() != merge.Depth() || cms.Width() != merge.Width() {
-		return ErrCannotMergeDifferentDimensions
+	if err := cms.compatible(other); err != nil {
+		return err
 	}
 
-	for r, row := range cms.grid {
-		for c := range row {
-			cms.grid[r][c] += merge.data(r, c)
+	if !cms.exact() {
+		for r := uint(0); r < cms.d; r++ {
+			for c := uint64(0); c < uint64(cms.w); c++ {
+				cell := other.raw(r, c)
+				if cms.morris == 0 {
+					cms.adjust(r, c, cell, true, 0)
+					continue
+				}
+				// add the values the counters stand for, not rounded counts
+				sum := cms.morrisValue(float64(cms.raw(r, c))) + cms.morrisValue(float64(cell))
+				cms.setRaw(r, c, cms.encodeMorris(sum, cms.draw()))
+			}
 		}
+		return nil
+	}
+
+	for r := uint(0); r < cms.d; r++ {
+		for c := uint64(0); c < uint64(cms.w); c++ {
+			if cms.mergeOverflows(cms.raw(r, c), other.raw(r, c)) {
+				return ErrOverflow
+			}
+		}
+	}
+	for r := uint(0); r < cms.d; r++ {
+		for c := uint64(0); c < uint64(cms.w); c++ {
+			cms.setRaw(r, c, cms.raw(r, c)+other.raw(r, c))
+		}
+	}
+	if cms.estimator == CountMeanMin {
+		cms.total = cms.rowTotal()
 	}
 
 	return nil
 }
 
+// mergeOverflows is true if adding other's counter to cell would overflow, callers must hold the lock
+func (cms *cmsketch) mergeOverflows(cell, other uint64) bool {
+	if cms.estimator == CountSketch {
+		return signedOverflows(int64(cell), int64(other))
+	}
+	return cell > math.MaxUint64-other
+}
+
+// compatible returns the error Merge would if other's counters don't line up with cms's
+func (cms *cmsketch) compatible(merge *cmsketch) error {
+	if cms.d != merge.d || cms.w != merge.w {
+		return ErrCannotMergeDifferentDimensions
+	}
+	other, mine := merge.config(), cms.config()
+	if other.family != mine.family || other.seed != mine.seed {
+		return ErrCannotMergeDifferentHashes
+	}
+	if other.estimator != mine.estimator {
+		return ErrCannotMergeDifferentEstimators
+	}
+	if other.conservative != mine.conservative {
+		return ErrCannotMergeDifferentModes
+	}
+	if other.bits != mine.bits || other.morris != mine.morris {
+		return ErrCannotMergeDifferentCounters
+	}
+	return nil
+}
+
 func (cms *cmsketch) Width() uint {
 	return cms.w
 }
@@ -161,8 +410,36 @@ func (cms *cmsketch) Size() uint {
 	return cms.d * cms.w
 }
 
-func (cms *cmsketch) data(x, y int) uint64 {
-	return cms.grid[x][y]
+// snapshot copies the sketch under its read lock, so Merge and InnerProduct can
+// read another sketch's counters without holding two locks at once
+func (cms *cmsketch) snapshot() *cmsketch {
+	cms.lock(false)
+	defer cms.unlock(false)
+
+	return &cmsketch{
+		d:            cms.d,
+		w:            cms.w,
+		cells:        slices.Clone(cms.cells),
+		bits:         cms.bits,
+		morris:       cms.morris,
+		family:       cms.family,
+		seed:         cms.seed,
+		h:            cms.h,
+		conservative: cms.conservative,
+		estimator:    cms.estimator,
+		total:        cms.total,
+	}
+}
+
+func (cms *cmsketch) config() config {
+	return config{
+		family:       cms.family,
+		seed:         cms.seed,
+		estimator:    cms.estimator,
+		conservative: cms.conservative,
+		bits:         cms.bits,
+		morris:       cms.morris,
+	}
 }
 
 func (cms *cmsketch) lock(write bool) {
@@ -183,6 +460,6 @@ func (cms *cmsketch) unlock(write bool) {
 	cms.mutex.RUnlock()
 }
 
-func (cms *cmsketch) getLocations(item []byte) []uint {
-	return cms.h(item)
+func (cms *cmsketch) getLocations(item []byte) locations {
+	return newLocations(cms.h.hash(item, cms.seed), uint64(cms.w))
 }
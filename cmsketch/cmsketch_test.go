@@ -2,9 +2,13 @@ package cmsketch
 
 import (
 	"fmt"
+	"maps"
+	"math"
 	"math/rand"
+	"slices"
 	"sync"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -21,11 +25,11 @@ func TestCMSketchCreate(t *testing.T) {
 		epsilon      float64
 		depth, width uint
 	}{
-		{0.9, 0.01, 4, 272},
-		{0.99, 0.001, 7, 2719},
-		{0.999, 0.0001, 10, 27183},
-		{0.9999, 0.0001, 14, 27183},
-		{0.99999, 0.0001, 17, 27183},
+		{0.9, 0.01, 3, 272},
+		{0.99, 0.001, 5, 2719},
+		{0.999, 0.0001, 7, 27183},
+		{0.9999, 0.0001, 10, 27183},
+		{0.99999, 0.0001, 12, 27183},
 	}
 
 	for _, c := range cases {
@@ -35,6 +39,77 @@ func TestCMSketchCreate(t *testing.T) {
 	}
 }
 
+func TestCMSketchCreateInvalid(t *testing.T) {
+	fmt.Println("TestCMSketchCreateInvalid")
+	cases := []struct {
+		delta, epsilon float64
+		err            error
+	}{
+		{0, 0.01, ErrInvalidDelta},
+		{-0.5, 0.01, ErrInvalidDelta},
+		{1, 0.01, ErrInvalidDelta},
+		{1.5, 0.01, ErrInvalidDelta},
+		{math.NaN(), 0.01, ErrInvalidDelta},
+		{0.99, 0, ErrInvalidEpsilon},
+		{0.99, -0.01, ErrInvalidEpsilon},
+		{0.99, math.NaN(), ErrInvalidEpsilon},
+		{0.99, math.Inf(1), ErrInvalidEpsilon},
+		{0.99, 1e-300, ErrInvalidDimensions},
+	}
+
+	for _, c := range cases {
+		for _, create := range []func(float64, float64, ...Option) (CMSketch, error){New, NewCountMeanMin, NewCountSketch} {
+			if _, err := create(c.delta, c.epsilon); err != c.err {
+				t.Errorf("delta:%f epsilon:%f expected error [%v], got [%v] instead", c.delta, c.epsilon, c.err, err)
+			}
+		}
+	}
+}
+
+func TestCMSketchWithDimensions(t *testing.T) {
+	fmt.Println("TestCMSketchWithDimensions")
+	cm, err := NewWithDimensions(4, 100)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 4, uint64(cm.Depth()), "Depth mismatched")
+	assert(t, 100, uint64(cm.Width()), "Width mismatched")
+	cm.Add([]byte("Alex"), 3)
+	assert(t, 3, cm.Count([]byte("Alex")), "Count mismatched")
+
+	for _, dims := range [][2]uint{{0, 100}, {4, 0}, {2, math.MaxUint}} {
+		if _, err := NewWithDimensions(dims[0], dims[1]); err != ErrInvalidDimensions {
+			t.Errorf("depth:%d width:%d expected error %s, got [%v] instead", dims[0], dims[1], ErrInvalidDimensions, err)
+		}
+	}
+}
+
+func TestCMSketchGuarantee(t *testing.T) {
+	fmt.Println("TestCMSketchGuarantee")
+	cases := []struct {
+		delta, epsilon float64
+	}{
+		{0.9, 0.01},
+		{0.99, 0.001},
+		{0.999, 0.0001},
+	}
+
+	for _, c := range cases {
+		cm, _ := New(c.delta, c.epsilon)
+		if cm.ErrorBound() > c.epsilon {
+			t.Errorf("epsilon:%f error bound %f is looser than asked for", c.epsilon, cm.ErrorBound())
+		}
+		if cm.Confidence() < c.delta {
+			t.Errorf("delta:%f confidence %f is lower than asked for", c.delta, cm.Confidence())
+		}
+	}
+
+	cm, _ := NewWithDimensions(3, 272)
+	if math.Abs(cm.ErrorBound()-math.E/272) > 1e-12 || math.Abs(cm.Confidence()-(1-math.Exp(-3))) > 1e-12 {
+		t.Errorf("Unexpected guarantee for 3x272, error bound:%f confidence:%f", cm.ErrorBound(), cm.Confidence())
+	}
+}
+
 func TestCMSketchAddSingle(t *testing.T) {
 	fmt.Println("TestCMSketchAddSingle")
 
@@ -77,12 +152,315 @@ func TestParallelAdds(t *testing.T) {
 }
 
 func TestCMSketchRemove(t *testing.T) {
+	fmt.Println("TestCMSketchRemove")
+	cm := createTestCMSketch()
+	cm.Add([]byte("Alex"), 10)
+	if err := cm.Remove([]byte("Alex"), 4); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 6, cm.Count([]byte("Alex")), "Count mismatched after Remove")
+
+	if err := cm.Remove([]byte("Alex"), 7); err != ErrUnderflow {
+		t.Errorf("Expected error %s, got [%v] instead", ErrUnderflow, err)
+	}
+	assert(t, 6, cm.Count([]byte("Alex")), "Count changed by a failed Remove")
+
+	if err := cm.Remove([]byte("Alex"), 6); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 0, cm.Count([]byte("Alex")), "Count mismatched after removing everything")
+	if err := cm.Remove([]byte("Alex"), 1); err != ErrUnderflow {
+		t.Errorf("Expected error %s, got [%v] instead", ErrUnderflow, err)
+	}
+}
+
+func TestCMSketchOverflow(t *testing.T) {
+	fmt.Println("TestCMSketchOverflow")
+	sketches := map[string]func(float64, float64, ...Option) (CMSketch, error){
+		"count-min":      New,
+		"count-mean-min": NewCountMeanMin,
+	}
+	for name, create := range sketches {
+		cm, _ := create(0.99, 0.01)
+		if err := cm.Add([]byte("Alex"), math.MaxUint64); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if err := cm.Add([]byte("Alex"), 1); err != ErrOverflow {
+			t.Errorf("%s: expected error %s, got [%v] instead", name, ErrOverflow, err)
+		}
+		assert(t, math.MaxUint64, cm.Count([]byte("Alex")), name+": Count changed by a failed Add")
+
+		other, _ := create(0.99, 0.01)
+		other.Add([]byte("Alex"), 1)
+		if err := cm.Merge(other); err != ErrOverflow {
+			t.Errorf("%s: expected error %s from Merge, got [%v] instead", name, ErrOverflow, err)
+		}
+		assert(t, math.MaxUint64, cm.Count([]byte("Alex")), name+": Count changed by a failed Merge")
+	}
+
+	conservative, _ := New(0.99, 0.01, WithConservativeUpdate())
+	conservative.Add([]byte("Alex"), math.MaxUint64)
+	if err := conservative.Add([]byte("Alex"), 1); err != ErrOverflow {
+		t.Errorf("conservative: expected error %s, got [%v] instead", ErrOverflow, err)
+	}
+
+	cs, _ := NewCountSketch(0.99, 0.01)
+	if err := cs.Add([]byte("Alex"), math.MaxInt64+1); err != ErrOverflow {
+		t.Errorf("count-sketch: expected error %s, got [%v] instead", ErrOverflow, err)
+	}
+	cs.Add([]byte("Alex"), math.MaxInt64)
+	if err := cs.Add([]byte("Alex"), 1); err != ErrOverflow {
+		t.Errorf("count-sketch: expected error %s, got [%v] instead", ErrOverflow, err)
+	}
+	assert(t, math.MaxInt64, cs.Count([]byte("Alex")), "count-sketch: Count changed by a failed Add")
 }
 
 func TestCMSketchCount(t *testing.T) {
+	fmt.Println("TestCMSketchCount")
+	cm, _ := New(0.9, 0.5)
+	sketch := cm.(*cmsketch)
+	ls := sketch.getLocations([]byte("Alex"))
+
+	// a zero in any row is the true minimum, wherever it is
+	for zero := uint(0); zero < sketch.d; zero++ {
+		for row := uint(0); row < sketch.d; row++ {
+			sketch.setRaw(row, ls.column(row), 5)
+		}
+		sketch.setRaw(zero, ls.column(zero), 0)
+		assert(t, 0, cm.Count([]byte("Alex")), fmt.Sprintf("Count mismatched with row %d zero", zero))
+	}
+
+	for row := uint(0); row < sketch.d; row++ {
+		sketch.setRaw(row, ls.column(row), uint64(10-row))
+	}
+	assert(t, uint64(10-(sketch.d-1)), cm.Count([]byte("Alex")), "Count isn't the smallest counter")
+}
+
+// op is a random Add or Remove for the property tests
+type op struct {
+	Item   uint8
+	Count  uint16
+	Remove bool
+}
+
+// Count-Min never underestimates, Remove fails when it would take any of an
+// item's counters below zero, and a failed Remove leaves the sketch unchanged
+func TestCMSketchProperties(t *testing.T) {
+	fmt.Println("TestCMSketchProperties")
+	property := func(ops []op) bool {
+		cm, _ := New(0.9, 0.1)
+		counts := make(map[uint8]uint64)
+		for _, o := range ops {
+			item := []byte{o.Item % 32}
+			before, _ := cm.MarshalBinary()
+			if !o.Remove {
+				if cm.Add(item, uint64(o.Count)) != nil {
+					return false
+				}
+				counts[item[0]] += uint64(o.Count)
+				continue
+			}
+
+			if counts[item[0]] >= uint64(o.Count) {
+				if cm.Remove(item, uint64(o.Count)) != nil {
+					return false
+				}
+				counts[item[0]] -= uint64(o.Count)
+				continue
+			}
+			// removing more than was added is only detectable when the estimate is
+			// too small, otherwise it would break the guarantee for colliding items
+			if cm.Count(item) >= uint64(o.Count) {
+				continue
+			}
+			err := cm.Remove(item, uint64(o.Count))
+			if after, _ := cm.MarshalBinary(); err != ErrUnderflow || string(before) != string(after) {
+				return false
+			}
+		}
+
+		for item, count := range counts {
+			if cm.Count([]byte{item}) < count {
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(1))}); err != nil {
+		t.Error(err)
+	}
+}
+
+// adding then removing the same counts restores every counter, for every estimator
+func TestCMSketchAddRemoveProperty(t *testing.T) {
+	fmt.Println("TestCMSketchAddRemoveProperty")
+	for _, create := range []func(float64, float64, ...Option) (CMSketch, error){New, NewCountMeanMin, NewCountSketch} {
+		property := func(items [][]byte, counts []uint32) bool {
+			cm, _ := create(0.9, 0.1)
+			cm.Add([]byte("base"), 3)
+			before, _ := cm.MarshalBinary()
+			n := min(len(items), len(counts))
+			for i := 0; i < n; i++ {
+				if cm.Add(items[i], uint64(counts[i])) != nil {
+					return false
+				}
+			}
+			for i := n - 1; i >= 0; i-- {
+				if cm.Remove(items[i], uint64(counts[i])) != nil {
+					return false
+				}
+			}
+			after, _ := cm.MarshalBinary()
+			return string(before) == string(after) && cm.Count([]byte("base")) == 3
+		}
+
+		if err := quick.Check(property, &quick.Config{MaxCount: 100, Rand: rand.New(rand.NewSource(2))}); err != nil {
+			t.Error(err)
+		}
+	}
 }
 
 func TestCMSketchHash(t *testing.T) {
+	fmt.Println("TestCMSketchHash")
+	cases := []struct {
+		family   HashFamily
+		input    string
+		seed     uint64
+		expected uint64
+	}{
+		{FNV, "", 0, 0xcbf29ce484222325},
+		{FNV, "a", 0, 0xaf63dc4c8601ec8c},
+		{XXHash, "", 0, 0xef46db3751d8e999},
+		{XXHash, "a", 0, 0xd24ec4f1a98c6e5b},
+		{XXHash, "abc", 0, 0x44bc2cf5ad770999},
+		{XXHash, "Nobody inspects the spammish repetition", 0, 0xfbcea83c8a378bf1},
+		{Murmur3, "", 0, 0},
+		{Murmur3, "hello", 0, 0xcbd8a7b341bd9b02},
+		{Murmur3, "The quick brown fox jumps over the lazy dog", 0, 0xe34bbc7bbc071b6c},
+	}
+
+	for _, c := range cases {
+		h, ok := c.family.hashFunc()
+		if !ok {
+			t.Errorf("Expected %s to have a hash function", c.family)
+			continue
+		}
+		assert(t, c.expected, h([]byte(c.input), c.seed), fmt.Sprintf("%s(%q)", c.family, c.input))
+	}
+}
+
+func TestCMSketchHashSeeded(t *testing.T) {
+	fmt.Println("TestCMSketchHashSeeded")
+	for _, family := range []HashFamily{FNV, XXHash, Murmur3} {
+		h, _ := family.hashFunc()
+		if h([]byte("Alex"), 1) == h([]byte("Alex"), 2) {
+			t.Errorf("Expected %s to hash differently with different seeds", family)
+		}
+		if h([]byte("Alex"), 1) != h([]byte("Alex"), 1) {
+			t.Errorf("Expected %s to hash the same with the same seed", family)
+		}
+	}
+}
+
+func TestCMSketchUnknownHash(t *testing.T) {
+	fmt.Println("TestCMSketchUnknownHash")
+	_, err := New(0.99, 0.001, WithHash(HashFamily(0)))
+	if err != ErrUnknownHashFamily {
+		t.Errorf("Expected error %s, got [%v] instead", ErrUnknownHashFamily, err)
+	}
+}
+
+func TestCMSketchHashFamilies(t *testing.T) {
+	fmt.Println("TestCMSketchHashFamilies")
+	for _, family := range []HashFamily{FNV, XXHash, Murmur3} {
+		cm, err := New(0.999, 0.001, WithHash(family), WithSeed(42))
+		if err != nil {
+			t.Errorf("Unexpected error creating %s sketch: %s", family, err)
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			cm.Add([]byte(fmt.Sprintf("item-%d", i)), uint64(i+1))
+		}
+		for i := 0; i < 100; i++ {
+			c := cm.Count([]byte(fmt.Sprintf("item-%d", i)))
+			if c < uint64(i+1) {
+				t.Errorf("%s: count for item-%d is %d, expected at least %d", family, i, c, i+1)
+			}
+		}
+	}
+}
+
+func TestCMSketchHashAllocations(t *testing.T) {
+	fmt.Println("TestCMSketchHashAllocations")
+	for _, family := range []HashFamily{FNV, XXHash, Murmur3} {
+		cm, _ := New(0.999, 0.001, WithHash(family))
+		item := []byte("Alex")
+		allocs := testing.AllocsPerRun(100, func() {
+			cm.Add(item, 1)
+			cm.Count(item)
+			cm.Remove(item, 1)
+		})
+		if allocs != 0 {
+			t.Errorf("Expected %s to allocate nothing, allocated %f per run", family, allocs)
+		}
+	}
+}
+
+func TestParallelCounts(t *testing.T) {
+	fmt.Println("TestParallelCounts")
+	cm := createTestCMSketch()
+	cm.Add([]byte("Alex"), 7)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if c := cm.Count([]byte("Alex")); c != 7 {
+					t.Errorf("Count mismatched -- expected:[7] actual:[%d]", c)
+					return
+				}
+				cm.Count([]byte(fmt.Sprintf("other-%d-%d", i, j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestParallelMerges(t *testing.T) {
+	fmt.Println("TestParallelMerges")
+	cm1 := createTestCMSketch()
+	cm2 := createTestCMSketch()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			cm2.Add([]byte("Alex"), 1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := cm1.Merge(cm2); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+			if _, err := cm1.InnerProduct(cm2); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if err := cm1.Merge(cm1); err != nil {
+		t.Fatalf("Unexpected error merging a sketch with itself: %s", err)
+	}
+	assert(t, 500, cm2.Count([]byte("Alex")), "Count mismatched")
 }
 
 func TestCMSketchMerge(t *testing.T) {
@@ -117,6 +495,107 @@ func TestCMSketchMergeUneven(t *testing.T) {
 	}
 }
 
+func TestCMSketchMergeDifferentHashes(t *testing.T) {
+	fmt.Println("TestCMSketchMergeDifferentHashes")
+	cases := []struct {
+		name  string
+		other []Option
+		err   error
+	}{
+		{"same", []Option{WithHash(XXHash), WithSeed(7)}, nil},
+		{"seed", []Option{WithHash(XXHash), WithSeed(8)}, ErrCannotMergeDifferentHashes},
+		{"family", []Option{WithHash(Murmur3), WithSeed(7)}, ErrCannotMergeDifferentHashes},
+	}
+
+	for _, c := range cases {
+		cm1, _ := New(0.999, 0.001, WithHash(XXHash), WithSeed(7))
+		cm2, _ := New(0.999, 0.001, c.other...)
+		if err := cm1.Merge(cm2); err != c.err {
+			t.Errorf("%s: expected error [%v], got [%v] instead", c.name, c.err, err)
+		}
+	}
+}
+
+// zipf returns the true counts of a Zipfian stream of n items over m distinct keys
+func zipf(n, m int) map[string]uint64 {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.1, 1, uint64(m-1))
+	counts := make(map[string]uint64)
+	for i := 0; i < n; i++ {
+		counts[fmt.Sprintf("item-%d", z.Uint64())]++
+	}
+	return counts
+}
+
+// totalError sums how far the sketch overestimates every key, failing on an underestimate
+func totalError(t *testing.T, cm CMSketch, counts map[string]uint64) uint64 {
+	var total uint64
+	for key, count := range counts {
+		estimate := cm.Count([]byte(key))
+		if estimate < count {
+			t.Errorf("Count of %s underestimated -- expected at least:[%d] actual:[%d]", key, count, estimate)
+		}
+		total += estimate - count
+	}
+	return total
+}
+
+func TestCMSketchConservativeUpdate(t *testing.T) {
+	fmt.Println("TestCMSketchConservativeUpdate")
+	counts := zipf(100000, 5000)
+	standard, _ := New(0.99, 0.01)
+	conservative, _ := New(0.99, 0.01, WithConservativeUpdate())
+	// add one at a time, conservative update's advantage comes from the order of the stream
+	r := rand.New(rand.NewSource(2))
+	var stream []string
+	for _, key := range slices.Sorted(maps.Keys(counts)) {
+		for i := uint64(0); i < counts[key]; i++ {
+			stream = append(stream, key)
+		}
+	}
+	r.Shuffle(len(stream), func(i, j int) { stream[i], stream[j] = stream[j], stream[i] })
+	for _, key := range stream {
+		standard.Add([]byte(key), 1)
+		conservative.Add([]byte(key), 1)
+	}
+
+	standardError := totalError(t, standard, counts)
+	conservativeError := totalError(t, conservative, counts)
+	if conservativeError*4 > standardError*3 {
+		t.Errorf("Expected conservative update to cut the error by at least a quarter, standard:%d conservative:%d", standardError, conservativeError)
+	}
+}
+
+func TestCMSketchConservativeRemove(t *testing.T) {
+	fmt.Println("TestCMSketchConservativeRemove")
+	cm, _ := New(0.99, 0.01, WithConservativeUpdate())
+	cm.Add([]byte("Alex"), 3)
+	if err := cm.Remove([]byte("Alex"), 1); err != ErrConservativeRemove {
+		t.Errorf("Expected error %s, got [%v] instead", ErrConservativeRemove, err)
+	}
+	assert(t, 3, cm.Count([]byte("Alex")), "Count mismatched")
+}
+
+func TestCMSketchMergeDifferentModes(t *testing.T) {
+	fmt.Println("TestCMSketchMergeDifferentModes")
+	standard, _ := New(0.99, 0.01)
+	conservative, _ := New(0.99, 0.01, WithConservativeUpdate())
+	if err := standard.Merge(conservative); err != ErrCannotMergeDifferentModes {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentModes, err)
+	}
+	if err := conservative.Merge(standard); err != ErrCannotMergeDifferentModes {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentModes, err)
+	}
+
+	other, _ := New(0.99, 0.01, WithConservativeUpdate())
+	conservative.Add([]byte("Alex"), 2)
+	other.Add([]byte("Alex"), 3)
+	if err := conservative.Merge(other); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 5, conservative.Count([]byte("Alex")), "Count mismatched")
+}
+
 func TestSize(t *testing.T) {
 	fmt.Println("TestSize")
 
@@ -0,0 +1,226 @@
+package cmsketch
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+var (
+	// ErrInvalidCounterBits when WithCounterBits is given a width other than 8, 16, 32 or 64
+	ErrInvalidCounterBits = errors.New("counter bits must be 8, 16, 32 or 64")
+	// ErrInvalidMorrisBase when WithMorrisCounting is given a growth rate that isn't positive
+	ErrInvalidMorrisBase = errors.New("morris counting growth rate must be positive")
+	// ErrCounterEstimator when narrow or Morris counters are used with an Estimator other than CountMin
+	ErrCounterEstimator = errors.New("narrow and Morris counters are only supported by the CountMin estimator")
+	// ErrCannotMergeDifferentCounters when CMSketch.Merge is invoked with another CMSketch whose counters differ
+	ErrCannotMergeDifferentCounters = errors.New("cannot merge CMSketch objects with different counters")
+)
+
+// WithCounterBits sets the width of each counter to 8, 16, 32 or the default 64
+// bits. Counters narrower than 64 bits saturate, once a counter reaches its
+// largest value it stays there: Add can't overflow it and Remove leaves it alone,
+// so Count reports the largest value for any item whose counters all saturated.
+func WithCounterBits(bits uint) Option {
+	return func(cms *cmsketch) {
+		cms.bits = bits
+	}
+}
+
+// WithMorrisCounting makes counters approximate, a counter holding c stands for
+// ((1+a)^c - 1) / a and updates round randomly between the two nearest counter
+// values so estimates stay unbiased. Narrow counters then reach far larger counts,
+// at the cost of a relative standard error of about sqrt(a/2) per counter. An
+// update rounds all of an item's counters with the same random draw, so they move
+// together and taking their minimum doesn't bias the count low. The rounding is
+// seeded by the sketch's seed, so a sketch is reproducible.
+func WithMorrisCounting(a float64) Option {
+	return func(cms *cmsketch) {
+		cms.morris = a
+		if !(a > 0) {
+			cms.morris = math.NaN()
+		}
+	}
+}
+
+// validateCounters checks the counter options and allocates the counters
+func (cms *cmsketch) validateCounters() error {
+	switch cms.bits {
+	case 8, 16, 32, 64:
+	default:
+		return ErrInvalidCounterBits
+	}
+	if math.IsNaN(cms.morris) || math.IsInf(cms.morris, 0) {
+		return ErrInvalidMorrisBase
+	}
+	if cms.estimator != CountMin && (cms.bits != 64 || cms.morris != 0) {
+		return ErrCounterEstimator
+	}
+	if cms.morris != 0 {
+		cms.rng = rand.New(rand.NewPCG(cms.seed, 0x9e3779b97f4a7c15))
+	}
+
+	cms.cells = make([]uint64, cms.words())
+	return nil
+}
+
+// words is how many uint64s the d*w counters are packed into
+func (cms *cmsketch) words() uint64 {
+	per := uint64(64 / cms.bits)
+	return (uint64(cms.d)*uint64(cms.w) + per - 1) / per
+}
+
+// exact is true if counters hold plain 64 bit counts, which the update paths handle
+// without saturation or Morris counting
+func (cms *cmsketch) exact() bool {
+	return cms.bits == 64 && cms.morris == 0
+}
+
+// limit is the largest value a counter can hold
+func (cms *cmsketch) limit() uint64 {
+	if cms.bits == 64 {
+		return math.MaxUint64
+	}
+	return 1<<cms.bits - 1
+}
+
+// raw is the counter in row and col as stored, callers must hold the lock
+func (cms *cmsketch) raw(row uint, col uint64) uint64 {
+	i := uint64(row)*uint64(cms.w) + col
+	if cms.bits == 64 {
+		return cms.cells[i]
+	}
+	per := uint64(64 / cms.bits)
+	shift := (i % per) * uint64(cms.bits)
+	return cms.cells[i/per] >> shift & cms.limit()
+}
+
+// setRaw stores v, which must fit in a counter, in row and col, callers must hold the write lock
+func (cms *cmsketch) setRaw(row uint, col uint64, v uint64) {
+	i := uint64(row)*uint64(cms.w) + col
+	if cms.bits == 64 {
+		cms.cells[i] = v
+		return
+	}
+	per := uint64(64 / cms.bits)
+	shift := (i % per) * uint64(cms.bits)
+	word := &cms.cells[i/per]
+	*word = *word&^(cms.limit()<<shift) | v<<shift
+}
+
+// value is the count a counter stands for, callers must hold the lock
+func (cms *cmsketch) value(row uint, col uint64) uint64 {
+	return cms.decode(cms.raw(row, col))
+}
+
+// decode turns a stored counter into the count it stands for
+func (cms *cmsketch) decode(c uint64) uint64 {
+	if cms.morris == 0 {
+		return c
+	}
+	v := math.Round(cms.morrisValue(float64(c)))
+	if v >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(v)
+}
+
+// store sets the counter in row and col to stand for v, saturating at the
+// largest value the counter can hold. Morris counters round up when draw, from
+// draw(), is below the fraction of the way v is to the next counter value.
+// Callers must hold the write lock.
+func (cms *cmsketch) store(row uint, col uint64, v uint64, draw float64) {
+	cms.setRaw(row, col, cms.encode(v, draw))
+}
+
+// draw is the random number an update rounds Morris counters with, callers must hold the write lock
+func (cms *cmsketch) draw() float64 {
+	if cms.morris == 0 {
+		return 0
+	}
+	return cms.rng.Float64()
+}
+
+// encode turns a count into the counter that stands for it
+func (cms *cmsketch) encode(v uint64, draw float64) uint64 {
+	if cms.morris == 0 {
+		return min(v, cms.limit())
+	}
+	return cms.encodeMorris(float64(v), draw)
+}
+
+// encodeMorris turns a count into the Morris counter that stands for it, working
+// in floats so repeated updates don't accumulate rounding
+func (cms *cmsketch) encodeMorris(x, draw float64) uint64 {
+	// the counter whose value is just below x, then round up with the probability
+	// that makes the expected value x
+	x = max(x, 0)
+	c := math.Floor(math.Log1p(x*cms.morris) / math.Log1p(cms.morris))
+	low, high := cms.morrisValue(c), cms.morrisValue(c+1)
+	if high > low && draw < (x-low)/(high-low) {
+		c++
+	}
+	return min(uint64(c), cms.limit())
+}
+
+func (cms *cmsketch) morrisValue(c float64) float64 {
+	return math.Expm1(c*math.Log1p(cms.morris)) / cms.morris
+}
+
+// saturated is true if the counter can't count any higher, callers must hold the lock
+func (cms *cmsketch) saturated(row uint, col uint64) bool {
+	return !cms.exact() && cms.raw(row, col) == cms.limit()
+}
+
+// adjust adds count to, or takes it from, the counter in row and col, saturating
+// at the largest value it can hold, callers must hold the write lock
+func (cms *cmsketch) adjust(row uint, col uint64, count uint64, add bool, draw float64) {
+	c := cms.raw(row, col)
+	if cms.morris != 0 {
+		delta := float64(count)
+		if !add {
+			delta = -delta
+		}
+		cms.setRaw(row, col, cms.encodeMorris(cms.morrisValue(float64(c))+delta, draw))
+		return
+	}
+	if !add {
+		cms.setRaw(row, col, c-count)
+		return
+	}
+	cms.setRaw(row, col, c+min(count, cms.limit()-c))
+}
+
+// addApproximate is Add for narrow or Morris counters, which saturate rather than overflow
+func (cms *cmsketch) addApproximate(ls locations, count uint64) {
+	draw := cms.draw()
+	for i := uint(0); i < cms.d; i++ {
+		cms.adjust(i, ls.column(i), count, true, draw)
+	}
+}
+
+// removeApproximate is Remove for narrow or Morris counters, saturated counters are left alone
+func (cms *cmsketch) removeApproximate(ls locations, count uint64) error {
+	for i := uint(0); i < cms.d; i++ {
+		y := ls.column(i)
+		if !cms.saturated(i, y) && cms.value(i, y) < count {
+			return ErrUnderflow
+		}
+	}
+	draw := cms.draw()
+	for i := uint(0); i < cms.d; i++ {
+		y := ls.column(i)
+		if !cms.saturated(i, y) {
+			cms.adjust(i, y, count, false, draw)
+		}
+	}
+	return nil
+}
+
+// MemoryUsage returns the number of bytes the sketch's counters take
+func (cms *cmsketch) MemoryUsage() uint64 {
+	cms.lock(false)
+	defer cms.unlock(false)
+
+	return uint64(len(cms.cells)) * 8
+}
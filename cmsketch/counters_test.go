@@ -0,0 +1,178 @@
+package cmsketch
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCountersPacking(t *testing.T) {
+	fmt.Println("TestCountersPacking")
+	r := rand.New(rand.NewSource(1))
+	for _, bits := range []uint{8, 16, 32, 64} {
+		cm, _ := New(0.9, 0.01, WithCounterBits(bits))
+		sketch := cm.(*cmsketch)
+		expected := make([]uint64, sketch.d*sketch.w)
+		for i := 0; i < 5000; i++ {
+			cell := r.Intn(len(expected))
+			v := r.Uint64() & sketch.limit()
+			expected[cell] = v
+			sketch.setRaw(uint(cell)/sketch.w, uint64(cell)%uint64(sketch.w), v)
+		}
+		for cell, v := range expected {
+			assert(t, v, sketch.raw(uint(cell)/sketch.w, uint64(cell)%uint64(sketch.w)), fmt.Sprintf("%d bit counter %d mismatched", bits, cell))
+		}
+	}
+}
+
+func TestCountersMemoryUsage(t *testing.T) {
+	fmt.Println("TestCountersMemoryUsage")
+	cases := []struct {
+		bits     uint
+		expected uint64
+	}{
+		// 3 rows of 272 counters
+		{64, 3 * 272 * 8},
+		{32, 3 * 272 * 4},
+		{16, 3 * 272 * 2},
+		{8, 3 * 272},
+	}
+
+	for _, c := range cases {
+		cm, _ := New(0.9, 0.01, WithCounterBits(c.bits))
+		assert(t, c.expected, cm.MemoryUsage(), fmt.Sprintf("Memory of %d bit counters mismatched", c.bits))
+	}
+}
+
+func TestCountersSaturate(t *testing.T) {
+	fmt.Println("TestCountersSaturate")
+	cm, _ := New(0.99, 0.01, WithCounterBits(8))
+	if err := cm.Add([]byte("Alex"), 300); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 255, cm.Count([]byte("Alex")), "Count didn't saturate")
+	cm.Add([]byte("Alex"), 1)
+	assert(t, 255, cm.Count([]byte("Alex")), "Count went past saturation")
+	if err := cm.Remove([]byte("Alex"), 100); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 255, cm.Count([]byte("Alex")), "Remove changed a saturated count")
+
+	cm.Add([]byte("Sward"), 10)
+	if err := cm.Remove([]byte("Sward"), 11); err != ErrUnderflow {
+		t.Errorf("Expected error %s, got [%v] instead", ErrUnderflow, err)
+	}
+	cm.Remove([]byte("Sward"), 4)
+	assert(t, 6, cm.Count([]byte("Sward")), "Count mismatched")
+
+	conservative, _ := New(0.99, 0.01, WithCounterBits(16), WithConservativeUpdate())
+	conservative.Add([]byte("Alex"), 70000)
+	assert(t, 65535, conservative.Count([]byte("Alex")), "Conservative count didn't saturate")
+}
+
+func TestCountersMorris(t *testing.T) {
+	fmt.Println("TestCountersMorris")
+	cm, _ := New(0.99, 0.01, WithCounterBits(8), WithMorrisCounting(0.1))
+	cm.Add([]byte("big"), 1000000000)
+	for i := 0; i < 20000; i++ {
+		cm.Add([]byte("stream"), 1)
+	}
+
+	cases := []struct {
+		item     string
+		expected float64
+	}{
+		{"big", 1000000000},
+		{"stream", 20000},
+	}
+	for _, c := range cases {
+		actual := float64(cm.Count([]byte(c.item)))
+		if actual < c.expected*0.75 || actual > c.expected*1.25 {
+			t.Errorf("Morris count of %s is %f, expected within 25%% of %f", c.item, actual, c.expected)
+		}
+	}
+
+	if err := cm.Remove([]byte("big"), 500000000); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if actual := float64(cm.Count([]byte("big"))); actual < 500000000*0.75 || actual > 500000000*1.25 {
+		t.Errorf("Morris count after Remove is %f, expected within 25%% of 500000000", actual)
+	}
+}
+
+func TestCountersInvalid(t *testing.T) {
+	fmt.Println("TestCountersInvalid")
+	cases := []struct {
+		name string
+		opts []Option
+		err  error
+	}{
+		{"bits", []Option{WithCounterBits(12)}, ErrInvalidCounterBits},
+		{"zero morris", []Option{WithMorrisCounting(0)}, ErrInvalidMorrisBase},
+		{"negative morris", []Option{WithMorrisCounting(-1)}, ErrInvalidMorrisBase},
+	}
+	for _, c := range cases {
+		if _, err := New(0.99, 0.01, c.opts...); err != c.err {
+			t.Errorf("%s: expected error [%v], got [%v] instead", c.name, c.err, err)
+		}
+	}
+
+	if _, err := NewCountSketch(0.99, 0.01, WithCounterBits(8)); err != ErrCounterEstimator {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCounterEstimator, err)
+	}
+	if _, err := NewCountMeanMin(0.99, 0.01, WithMorrisCounting(0.1)); err != ErrCounterEstimator {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCounterEstimator, err)
+	}
+}
+
+func TestCountersMerge(t *testing.T) {
+	fmt.Println("TestCountersMerge")
+	cm1, _ := New(0.99, 0.01, WithCounterBits(8))
+	cm2, _ := New(0.99, 0.01, WithCounterBits(8))
+	cm1.Add([]byte("Alex"), 200)
+	cm2.Add([]byte("Alex"), 100)
+	cm2.Add([]byte("Sward"), 7)
+	if err := cm1.Merge(cm2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 255, cm1.Count([]byte("Alex")), "Merged count didn't saturate")
+	assert(t, 7, cm1.Count([]byte("Sward")), "Merged count mismatched")
+
+	wide, _ := New(0.99, 0.01, WithCounterBits(16))
+	if err := cm1.Merge(wide); err != ErrCannotMergeDifferentCounters {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentCounters, err)
+	}
+	morris, _ := New(0.99, 0.01, WithCounterBits(8), WithMorrisCounting(0.1))
+	if err := cm1.Merge(morris); err != ErrCannotMergeDifferentCounters {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentCounters, err)
+	}
+}
+
+func TestCountersEncoding(t *testing.T) {
+	fmt.Println("TestCountersEncoding")
+	cases := [][]Option{
+		{WithCounterBits(8)},
+		{WithCounterBits(16), WithConservativeUpdate()},
+		{WithCounterBits(32), WithMorrisCounting(0.05)},
+	}
+
+	for _, opts := range cases {
+		cm, _ := New(0.99, 0.01, opts...)
+		for i := 0; i < 100; i++ {
+			cm.Add([]byte(fmt.Sprintf("item-%d", i)), uint64(i*i))
+		}
+		data, _ := cm.MarshalBinary()
+		decoded, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		assert(t, cm.MemoryUsage(), decoded.MemoryUsage(), "Memory usage mismatched")
+		for i := 0; i < 100; i++ {
+			item := []byte(fmt.Sprintf("item-%d", i))
+			assert(t, cm.Count(item), decoded.Count(item), fmt.Sprintf("Count of %s mismatched", item))
+		}
+		if err := decoded.Merge(cm); err != nil {
+			t.Errorf("Expected decoded sketch to merge with its original, got [%s]", err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package cmsketch
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+// binaryVersion is the first byte of the binary encoding of a CMSketch
+const binaryVersion = 1
+
+// flags recorded in the header of the binary encoding
+const (
+	flagConservative = 1 << iota
+	// flagMorris is followed by the growth rate as a little endian float64 after the counter bits
+	flagMorris
+)
+
+var (
+	// ErrInvalidEncoding when decoding data that isn't an encoded CMSketch
+	ErrInvalidEncoding = errors.New("invalid encoded CMSketch")
+	// ErrUnsupportedVersion when decoding a CMSketch written by a newer version of this package
+	ErrUnsupportedVersion = errors.New("unsupported CMSketch encoding version")
+)
+
+// Unmarshal returns the CMSketch encoded by MarshalBinary, it keeps the hash
+// family and seed of the original so the two can still be merged
+func Unmarshal(data []byte) (CMSketch, error) {
+	cm := &cmsketch{}
+	if err := cm.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// MarshalBinary encodes the sketch as a version byte, the hash family byte, a
+// flags byte, the estimator byte, the counter bits byte, the Morris growth rate
+// as a little endian float64 if flagMorris is set, then the seed, depth, width
+// and every counter row by row as uvarints. A CountSketch's counters are signed
+// and written as varints.
+func (cms *cmsketch) MarshalBinary() ([]byte, error) {
+	cms.lock(false)
+	defer cms.unlock(false)
+
+	var flags byte
+	if cms.conservative {
+		flags |= flagConservative
+	}
+	if cms.morris != 0 {
+		flags |= flagMorris
+	}
+	buf := []byte{binaryVersion, byte(cms.family), flags, byte(cms.estimator), byte(cms.bits)}
+	if cms.morris != 0 {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(cms.morris))
+	}
+	buf = binary.AppendUvarint(buf, cms.seed)
+	buf = binary.AppendUvarint(buf, uint64(cms.d))
+	buf = binary.AppendUvarint(buf, uint64(cms.w))
+	for r := uint(0); r < cms.d; r++ {
+		for c := uint64(0); c < uint64(cms.w); c++ {
+			if cms.estimator == CountSketch {
+				buf = binary.AppendVarint(buf, int64(cms.raw(r, c)))
+				continue
+			}
+			buf = binary.AppendUvarint(buf, cms.raw(r, c))
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the sketch with the one encoded by MarshalBinary
+func (cms *cmsketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return ErrInvalidEncoding
+	}
+	version := data[0]
+	if version != binaryVersion {
+		return ErrUnsupportedVersion
+	}
+	family := HashFamily(data[1])
+	h, ok := family.hashFunc()
+	if !ok {
+		return ErrUnknownHashFamily
+	}
+	if len(data) < 5 {
+		return ErrInvalidEncoding
+	}
+	flags, estimator, bits := data[2], Estimator(data[3]), uint(data[4])
+	data = data[5:]
+	if flags&^(flagConservative|flagMorris) != 0 {
+		return ErrInvalidEncoding
+	}
+	if estimator < CountMin || estimator > CountSketch {
+		return ErrInvalidEncoding
+	}
+	conservative := flags&flagConservative != 0
+	if conservative && estimator != CountMin {
+		return ErrInvalidEncoding
+	}
+	var morris float64
+	if flags&flagMorris != 0 {
+		if len(data) < 8 {
+			return ErrInvalidEncoding
+		}
+		morris, data = math.Float64frombits(binary.LittleEndian.Uint64(data)), data[8:]
+		if !(morris > 0) || math.IsInf(morris, 0) {
+			return ErrInvalidEncoding
+		}
+	}
+
+	var header [3]uint64
+	for i := range header {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return ErrInvalidEncoding
+		}
+		header[i] = v
+		data = data[n:]
+	}
+	seed, d, w := header[0], header[1], header[2]
+	// every counter takes at least a byte, which bounds what we'll allocate
+	if d == 0 || w == 0 || d > uint64(len(data)) || w > uint64(len(data))/d {
+		return ErrInvalidEncoding
+	}
+
+	decoded := &cmsketch{
+		d:            uint(d),
+		w:            uint(w),
+		bits:         bits,
+		morris:       morris,
+		seed:         seed,
+		estimator:    estimator,
+		conservative: conservative,
+	}
+	if decoded.validateCounters() != nil {
+		return ErrInvalidEncoding
+	}
+	for r := uint(0); r < decoded.d; r++ {
+		for c := uint64(0); c < w; c++ {
+			var v uint64
+			var n int
+			if estimator == CountSketch {
+				signed, sn := binary.Varint(data)
+				v, n = uint64(signed), sn
+			} else {
+				v, n = binary.Uvarint(data)
+			}
+			if n <= 0 || v > decoded.limit() {
+				return ErrInvalidEncoding
+			}
+			decoded.setRaw(r, c, v)
+			data = data[n:]
+		}
+	}
+	if len(data) != 0 {
+		return ErrInvalidEncoding
+	}
+
+	cms.lock(true)
+	defer cms.unlock(true)
+
+	cms.d, cms.w = decoded.d, decoded.w
+	cms.cells, cms.bits, cms.morris, cms.rng = decoded.cells, bits, morris, decoded.rng
+	cms.family, cms.seed, cms.h = family, seed, h
+	cms.conservative, cms.estimator = conservative, estimator
+	cms.total = 0
+	if estimator == CountMeanMin {
+		cms.total = cms.rowTotal()
+	}
+	return nil
+}
+
+// jsonSketch is the JSON form of a CMSketch
+type jsonSketch struct {
+	Version      int     `json:"version"`
+	Hash         string  `json:"hash"`
+	Seed         uint64  `json:"seed"`
+	Conservative bool    `json:"conservative"`
+	Estimator    string  `json:"estimator"`
+	CounterBits  uint    `json:"counterBits"`
+	Morris       float64 `json:"morris,omitempty"`
+	Depth        uint    `json:"depth"`
+	Width        uint    `json:"width"`
+	// Grid holds the counters as stored, [][]uint64 or [][]int64 for a CountSketch
+	Grid any `json:"grid"`
+}
+
+// MarshalJSON exports the sketch's parameters and counters for debugging, it
+// can't be decoded back into a CMSketch, use MarshalBinary for that
+func (cms *cmsketch) MarshalJSON() ([]byte, error) {
+	cms.lock(false)
+	defer cms.unlock(false)
+
+	var grid any
+	if cms.estimator == CountSketch {
+		signed := make([][]int64, cms.d)
+		for r := range signed {
+			signed[r] = make([]int64, cms.w)
+			for c := range signed[r] {
+				signed[r][c] = int64(cms.raw(uint(r), uint64(c)))
+			}
+		}
+		grid = signed
+	} else {
+		unsigned := make([][]uint64, cms.d)
+		for r := range unsigned {
+			unsigned[r] = make([]uint64, cms.w)
+			for c := range unsigned[r] {
+				unsigned[r][c] = cms.raw(uint(r), uint64(c))
+			}
+		}
+		grid = unsigned
+	}
+
+	return json.Marshal(jsonSketch{
+		Version:      binaryVersion,
+		Hash:         cms.family.String(),
+		Seed:         cms.seed,
+		Conservative: cms.conservative,
+		Estimator:    cms.estimator.String(),
+		CounterBits:  cms.bits,
+		Morris:       cms.morris,
+		Depth:        cms.d,
+		Width:        cms.w,
+		Grid:         grid,
+	})
+}
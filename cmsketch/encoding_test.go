@@ -0,0 +1,199 @@
+package cmsketch
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestCMSketchBinaryRoundTrip(t *testing.T) {
+	fmt.Println("TestCMSketchBinaryRoundTrip")
+	cm, _ := New(0.99, 0.01, WithHash(Murmur3), WithSeed(99))
+	for i := 0; i < 50; i++ {
+		cm.Add([]byte(fmt.Sprintf("item-%d", i)), uint64(i*1000))
+	}
+
+	data, err := cm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling: %s", err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unexpected error unmarshalling: %s", err)
+	}
+
+	assert(t, uint64(cm.Depth()), uint64(decoded.Depth()), "Depth mismatched")
+	assert(t, uint64(cm.Width()), uint64(decoded.Width()), "Width mismatched")
+	for i := 0; i < 50; i++ {
+		item := []byte(fmt.Sprintf("item-%d", i))
+		assert(t, cm.Count(item), decoded.Count(item), fmt.Sprintf("Count of %s mismatched", item))
+	}
+}
+
+func TestCMSketchUnmarshalMerge(t *testing.T) {
+	fmt.Println("TestCMSketchUnmarshalMerge")
+	cm, _ := New(0.99, 0.01, WithHash(XXHash), WithSeed(3))
+	cm.Add([]byte("Alex"), 2)
+
+	data, _ := cm.MarshalBinary()
+	decoded, _ := Unmarshal(data)
+	if err := decoded.Merge(cm); err != nil {
+		t.Fatalf("Expected decoded sketch to merge with its original, got [%s]", err)
+	}
+	if err := cm.Merge(decoded); err != nil {
+		t.Fatalf("Expected original sketch to merge with its decoded copy, got [%s]", err)
+	}
+	assert(t, 6, cm.Count([]byte("Alex")), "Count mismatched")
+
+	other, _ := New(0.99, 0.01, WithHash(XXHash), WithSeed(4))
+	if err := decoded.Merge(other); err != ErrCannotMergeDifferentHashes {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentHashes, err)
+	}
+}
+
+func TestCMSketchUnmarshalInto(t *testing.T) {
+	fmt.Println("TestCMSketchUnmarshalInto")
+	src, _ := New(0.9, 0.1)
+	src.Add([]byte("Alex"), 5)
+	data, _ := src.MarshalBinary()
+
+	dst := createTestCMSketch()
+	if err := dst.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, uint64(src.Width()), uint64(dst.Width()), "Width mismatched")
+	assert(t, 5, dst.Count([]byte("Alex")), "Count mismatched")
+}
+
+func TestCMSketchUnmarshalConservative(t *testing.T) {
+	fmt.Println("TestCMSketchUnmarshalConservative")
+	cm, _ := New(0.99, 0.01, WithConservativeUpdate())
+	cm.Add([]byte("Alex"), 4)
+
+	data, _ := cm.MarshalBinary()
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := decoded.Merge(cm); err != nil {
+		t.Fatalf("Expected decoded sketch to merge with its original, got [%s]", err)
+	}
+	assert(t, 8, decoded.Count([]byte("Alex")), "Count mismatched")
+
+	standard, _ := New(0.99, 0.01)
+	if err := decoded.Merge(standard); err != ErrCannotMergeDifferentModes {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentModes, err)
+	}
+}
+
+// golden is New(0.9, 0.5, WithSeed(5)) after Add("Alex", 42), it must keep decoding the same way
+const golden = "01010001400503062a0000000000000000002a0000002a000000"
+
+func TestCMSketchUnmarshalGolden(t *testing.T) {
+	fmt.Println("TestCMSketchUnmarshalGolden")
+	data, _ := hex.DecodeString(golden)
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 42, decoded.Count([]byte("Alex")), "Count mismatched")
+	if encoded, _ := decoded.MarshalBinary(); hex.EncodeToString(encoded) != golden {
+		t.Errorf("Expected sketch to encode as %s, got %x", golden, encoded)
+	}
+
+	cm, _ := New(0.9, 0.5, WithSeed(5))
+	cm.Add([]byte("Alex"), 42)
+	if encoded, _ := cm.MarshalBinary(); hex.EncodeToString(encoded) != golden {
+		t.Errorf("Expected a new sketch to encode as %s, got %x", golden, encoded)
+	}
+	if err := cm.Merge(decoded); err != nil {
+		t.Fatalf("Expected decoded sketch to merge, got [%s]", err)
+	}
+	assert(t, 84, cm.Count([]byte("Alex")), "Merged count mismatched")
+}
+
+func TestCMSketchUnmarshalEstimators(t *testing.T) {
+	fmt.Println("TestCMSketchUnmarshalEstimators")
+	for _, create := range []func(float64, float64, ...Option) (CMSketch, error){NewCountMeanMin, NewCountSketch} {
+		cm, _ := create(0.99, 0.01)
+		for i := 0; i < 200; i++ {
+			cm.Add([]byte(fmt.Sprintf("item-%d", i%20)), uint64(i))
+		}
+		cm.Remove([]byte("item-3"), 50)
+
+		data, _ := cm.MarshalBinary()
+		decoded, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		for i := 0; i < 20; i++ {
+			item := []byte(fmt.Sprintf("item-%d", i))
+			assert(t, cm.Count(item), decoded.Count(item), fmt.Sprintf("Count of %s mismatched", item))
+		}
+		if err := decoded.Merge(cm); err != nil {
+			t.Errorf("Expected decoded sketch to merge with its original, got [%s]", err)
+		}
+	}
+}
+
+func TestCMSketchUnmarshalInvalid(t *testing.T) {
+	fmt.Println("TestCMSketchUnmarshalInvalid")
+	cm, _ := New(0.9, 0.1)
+	valid, _ := cm.MarshalBinary()
+
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrInvalidEncoding},
+		{"version", append([]byte{binaryVersion + 1}, valid[1:]...), ErrUnsupportedVersion},
+		{"hash", append([]byte{binaryVersion, 0}, valid[2:]...), ErrUnknownHashFamily},
+		{"flags", append([]byte{binaryVersion, byte(FNV), 0x80}, valid[3:]...), ErrInvalidEncoding},
+		{"estimator", append([]byte{binaryVersion, byte(FNV), 0, byte(CountSketch + 1)}, valid[4:]...), ErrInvalidEncoding},
+		{"conservative estimator", append([]byte{binaryVersion, byte(FNV), flagConservative, byte(CountSketch)}, valid[4:]...), ErrInvalidEncoding},
+		{"counter bits", append([]byte{binaryVersion, byte(FNV), 0, byte(CountMin), 12}, valid[5:]...), ErrInvalidEncoding},
+		{"morris", append([]byte{binaryVersion, byte(FNV), flagMorris, byte(CountMin), 8, 0, 0, 0, 0, 0, 0, 0xf0, 0xbf}, valid[5:]...), ErrInvalidEncoding},
+		{"truncated", valid[:len(valid)-1], ErrInvalidEncoding},
+		{"trailing", append(append([]byte{}, valid...), 0), ErrInvalidEncoding},
+		{"huge", []byte{binaryVersion, byte(FNV), 0, byte(CountMin), 64, 0, 0xff, 0xff, 0xff, 0x0f, 0xff, 0xff, 0xff, 0x0f, 0}, ErrInvalidEncoding},
+	}
+
+	for _, c := range cases {
+		if _, err := Unmarshal(c.data); err != c.err {
+			t.Errorf("%s: expected error [%v], got [%v] instead", c.name, c.err, err)
+		}
+	}
+}
+
+func TestCMSketchJSON(t *testing.T) {
+	fmt.Println("TestCMSketchJSON")
+	cm, _ := New(0.9, 0.1, WithHash(XXHash), WithSeed(12))
+	cm.Add([]byte("Alex"), 3)
+
+	data, err := json.Marshal(cm)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var decoded struct {
+		Hash string
+		Seed uint64
+		Grid [][]uint64
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if decoded.Hash != "xxhash" || decoded.Seed != 12 {
+		t.Errorf("Expected xxhash seeded with 12, got %s seeded with %d", decoded.Hash, decoded.Seed)
+	}
+	assert(t, uint64(cm.Depth()), uint64(len(decoded.Grid)), "Rows mismatched")
+	var total uint64
+	for _, row := range decoded.Grid {
+		assert(t, uint64(cm.Width()), uint64(len(row)), "Columns mismatched")
+		for _, cell := range row {
+			total += cell
+		}
+	}
+	assert(t, 3*uint64(cm.Depth()), total, "Total of counters mismatched")
+}
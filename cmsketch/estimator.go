@@ -0,0 +1,138 @@
+package cmsketch
+
+import (
+	"math"
+	"slices"
+)
+
+// Estimator is how a sketch turns an item's counters into its count
+type Estimator uint8
+
+const (
+	// CountMin takes the smallest of an item's counters, it never underestimates
+	// but every collision inflates the count
+	CountMin Estimator = iota + 1
+	// CountMeanMin subtracts the expected noise of every row from the item's counter,
+	// then takes the median of those, capped by the CountMin estimate
+	CountMeanMin
+	// CountSketch adds or subtracts each count depending on a per row sign hash and
+	// takes the median of the signed counters, collisions cancel out in expectation
+	// so it's unbiased and suits turnstile streams with deletions
+	CountSketch
+)
+
+// String returns the name of the estimator
+func (e Estimator) String() string {
+	switch e {
+	case CountMin:
+		return "count-min"
+	case CountMeanMin:
+		return "count-mean-min"
+	case CountSketch:
+		return "count-sketch"
+	}
+	return "unknown"
+}
+
+// NewCountMeanMin returns a sketch that estimates with CountMeanMin, it takes
+// the same parameters as New
+func NewCountMeanMin(delta, epsilon float64, opts ...Option) (CMSketch, error) {
+	return newSketch(CountMeanMin, delta, epsilon, opts)
+}
+
+// NewCountSketch returns a sketch that estimates with CountSketch, it takes the
+// same parameters as New. Counts are signed internally, Count returns 0 for an
+// item whose estimate is negative. Its guarantee is weaker per row than CountMin's,
+// so Confidence reports less than delta for the same depth.
+func NewCountSketch(delta, epsilon float64, opts ...Option) (CMSketch, error) {
+	return newSketch(CountSketch, delta, epsilon, opts)
+}
+
+// addSigned adds direction*count to the item's signed counters. A CountSketch's
+// counters are int64 stored as uint64s, it returns ErrOverflow without
+// changing anything if count or any counter would overflow an int64.
+func (cms *cmsketch) addSigned(ls locations, count uint64, direction int64) error {
+	if count > math.MaxInt64 {
+		return ErrOverflow
+	}
+
+	delta := direction * int64(count)
+	for i := uint(0); i < cms.d; i++ {
+		if signedOverflows(int64(cms.raw(i, ls.column(i))), ls.sign(i)*delta) {
+			return ErrOverflow
+		}
+	}
+	for i := uint(0); i < cms.d; i++ {
+		y := ls.column(i)
+		cms.setRaw(i, y, cms.raw(i, y)+uint64(ls.sign(i)*delta))
+	}
+	return nil
+}
+
+// signedOverflows is true if a+b overflows an int64
+func signedOverflows(a, b int64) bool {
+	if b > 0 {
+		return a > math.MaxInt64-b
+	}
+	return a < math.MinInt64-b
+}
+
+// maxStackDepth is the deepest sketch whose median is found without allocating
+const maxStackDepth = 32
+
+// countSketch is the median of the item's signed counters, callers must hold the lock
+func (cms *cmsketch) countSketch(ls locations) uint64 {
+	var stack [maxStackDepth]int64
+	estimates := stack[:0]
+	for x := uint(0); x < cms.d; x++ {
+		estimates = append(estimates, ls.sign(x)*int64(cms.raw(x, ls.column(x))))
+	}
+
+	median := medianOf(estimates)
+	if median < 0 {
+		return 0
+	}
+	return uint64(median)
+}
+
+// countMeanMin is the median of the item's counters less the noise expected in
+// their rows, capped by the smallest counter, callers must hold the lock
+func (cms *cmsketch) countMeanMin(ls locations) uint64 {
+	upper := cms.estimate(ls)
+	if cms.w < 2 {
+		return upper
+	}
+
+	var stack [maxStackDepth]uint64
+	estimates := stack[:0]
+	for x := uint(0); x < cms.d; x++ {
+		c := cms.raw(x, ls.column(x))
+		noise := (cms.total - c) / uint64(cms.w-1)
+		// a row's estimate can't be negative, clamping first keeps the median in range
+		estimates = append(estimates, c-min(c, noise))
+	}
+
+	return min(medianOf(estimates), upper)
+}
+
+// medianOf sorts values in place and returns their median, the mean of the
+// middle two for an even number of values
+func medianOf[T int64 | uint64](values []T) T {
+	slices.Sort(values)
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[mid]
+	}
+	a, b := values[mid-1], values[mid]
+	return a/2 + b/2 + (a%2+b%2)/2
+}
+
+// rowTotal is the sum of the first row, the total count of a CountMin or
+// CountMeanMin sketch, callers must hold the lock
+func (cms *cmsketch) rowTotal() uint64 {
+	var total uint64
+	for c := uint64(0); c < uint64(cms.w); c++ {
+		total += cms.raw(0, c)
+	}
+	return total
+}
@@ -0,0 +1,129 @@
+package cmsketch
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCountSketchAddRemove(t *testing.T) {
+	fmt.Println("TestCountSketchAddRemove")
+	cm, _ := NewCountSketch(0.999, 0.001)
+	cm.Add([]byte("Alex"), 10)
+	assert(t, 10, cm.Count([]byte("Alex")), "Count mismatched after Add")
+	cm.Remove([]byte("Alex"), 4)
+	assert(t, 6, cm.Count([]byte("Alex")), "Count mismatched after Remove")
+	cm.Remove([]byte("Alex"), 10)
+	assert(t, 0, cm.Count([]byte("Alex")), "Negative count wasn't reported as 0")
+}
+
+func TestCountSketchTurnstile(t *testing.T) {
+	fmt.Println("TestCountSketchTurnstile")
+	cs, _ := NewCountSketch(0.99, 0.01)
+	for i := 0; i < 2000; i++ {
+		cs.Add([]byte(fmt.Sprintf("item-%d", i)), 50)
+	}
+	// delete everything but the first ten, collisions with deleted items cancel out
+	for i := 10; i < 2000; i++ {
+		cs.Remove([]byte(fmt.Sprintf("item-%d", i)), 50)
+	}
+
+	for i := 0; i < 2000; i++ {
+		expected := uint64(0)
+		if i < 10 {
+			expected = 50
+		}
+		item := []byte(fmt.Sprintf("item-%d", i))
+		actual := cs.Count(item)
+		if diff := max(actual, expected) - min(actual, expected); diff > 5 {
+			t.Errorf("Count of %s is %d, expected %d within 5", item, actual, expected)
+		}
+	}
+}
+
+func TestCountMeanMinError(t *testing.T) {
+	fmt.Println("TestCountMeanMinError")
+	counts := zipf(100000, 5000)
+	cm, _ := New(0.99, 0.01)
+	cmm, _ := NewCountMeanMin(0.99, 0.01)
+	for key, count := range counts {
+		cm.Add([]byte(key), count)
+		cmm.Add([]byte(key), count)
+	}
+
+	var cmError, cmmError uint64
+	for key, count := range counts {
+		estimate := cmm.Count([]byte(key))
+		if upper := cm.Count([]byte(key)); estimate > upper {
+			t.Errorf("Count-Mean-Min estimate of %s is %d, more than the Count-Min estimate %d", key, estimate, upper)
+		}
+		cmError += cm.Count([]byte(key)) - count
+		cmmError += max(estimate, count) - min(estimate, count)
+	}
+	if cmmError >= cmError {
+		t.Errorf("Expected Count-Mean-Min to have less error than Count-Min, count-min:%d count-mean-min:%d", cmError, cmmError)
+	}
+}
+
+func TestEstimatorMerge(t *testing.T) {
+	fmt.Println("TestEstimatorMerge")
+	for _, create := range []func(float64, float64, ...Option) (CMSketch, error){NewCountMeanMin, NewCountSketch} {
+		cm1, _ := create(0.999, 0.001)
+		cm2, _ := create(0.999, 0.001)
+		cm1.Add([]byte("Alex"), 3)
+		cm2.Add([]byte("Alex"), 4)
+		if err := cm1.Merge(cm2); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		assert(t, 7, cm1.Count([]byte("Alex")), "Count mismatched after merge")
+
+		standard := createTestCMSketch()
+		if err := standard.Merge(cm1); err != ErrCannotMergeDifferentEstimators {
+			t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentEstimators, err)
+		}
+	}
+}
+
+func TestEstimatorConservative(t *testing.T) {
+	fmt.Println("TestEstimatorConservative")
+	if _, err := NewCountSketch(0.99, 0.01, WithConservativeUpdate()); err != ErrConservativeEstimator {
+		t.Errorf("Expected error %s, got [%v] instead", ErrConservativeEstimator, err)
+	}
+	if _, err := NewCountMeanMin(0.99, 0.01, WithConservativeUpdate()); err != ErrConservativeEstimator {
+		t.Errorf("Expected error %s, got [%v] instead", ErrConservativeEstimator, err)
+	}
+}
+
+func TestEstimatorAllocations(t *testing.T) {
+	fmt.Println("TestEstimatorAllocations")
+	for _, create := range []func(float64, float64, ...Option) (CMSketch, error){NewCountMeanMin, NewCountSketch} {
+		cm, _ := create(0.999, 0.001)
+		item := []byte("Alex")
+		allocs := testing.AllocsPerRun(100, func() {
+			cm.Add(item, 1)
+			cm.Count(item)
+		})
+		if allocs != 0 {
+			t.Errorf("Expected no allocations, got %f per run", allocs)
+		}
+	}
+}
+
+func TestMedianOf(t *testing.T) {
+	fmt.Println("TestMedianOf")
+	cases := []struct {
+		values   []int64
+		expected int64
+	}{
+		{[]int64{5}, 5},
+		{[]int64{3, 1, 2}, 2},
+		{[]int64{4, 1, 3, 2}, 2},
+		{[]int64{-3, 5}, 1},
+		{[]int64{-7, -2, 9, 4, 0}, 0},
+	}
+
+	for _, c := range cases {
+		if actual := medianOf(append([]int64{}, c.values...)); actual != c.expected {
+			t.Errorf("medianOf(%v) -- expected:[%d] actual:[%d]", c.values, c.expected, actual)
+		}
+	}
+}
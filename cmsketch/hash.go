@@ -0,0 +1,220 @@
+package cmsketch
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// HashFamily identifies the hash function used to place items in a sketch. The
+// family and seed are part of a sketch's identity, only sketches built with the
+// same ones can be merged.
+type HashFamily uint8
+
+const (
+	// FNV is 64 bit FNV-1a, the seed is mixed into its offset basis
+	FNV HashFamily = iota + 1
+	// XXHash is 64 bit xxHash (XXH64)
+	XXHash
+	// Murmur3 is the first half of 128 bit MurmurHash3 for x64
+	Murmur3
+)
+
+// String returns the name of the hash family
+func (h HashFamily) String() string {
+	switch h {
+	case FNV:
+		return "fnv"
+	case XXHash:
+		return "xxhash"
+	case Murmur3:
+		return "murmur3"
+	}
+	return "unknown"
+}
+
+// hashFunc is a stateless, seeded 64 bit hash, it must not allocate
+type hashFunc func(item []byte, seed uint64) uint64
+
+// hash is the item's seeded hash passed through murmur3's finalizer, FNV in
+// particular leaves similar items with similar low bits, which would put them
+// in the same column of every row
+func (h hashFunc) hash(item []byte, seed uint64) uint64 {
+	return murmurFmix(h(item, seed))
+}
+
+func (h HashFamily) hashFunc() (hashFunc, bool) {
+	switch h {
+	case FNV:
+		return fnv1a, true
+	case XXHash:
+		return xxhash64, true
+	case Murmur3:
+		return murmur3, true
+	}
+	return nil, false
+}
+
+func fnv1a(item []byte, seed uint64) uint64 {
+	h := uint64(14695981039346656037) ^ seed
+	for _, b := range item {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	return h
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func xxhash64(item []byte, seed uint64) uint64 {
+	n := len(item)
+	var h uint64
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for ; len(item) >= 32; item = item[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(item[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(item[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(item[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(item[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(item) >= 8; item = item[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(item))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(item) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(item)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		item = item[4:]
+	}
+	for _, b := range item {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+func murmurFmix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+func murmur3(item []byte, seed uint64) uint64 {
+	n := len(item)
+	h1, h2 := seed, seed
+	for ; len(item) >= 16; item = item[16:] {
+		k1 := binary.LittleEndian.Uint64(item[0:8])
+		k2 := binary.LittleEndian.Uint64(item[8:16])
+
+		k1 *= murmurC1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= murmurC2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	for i := len(item) - 1; i >= 8; i-- {
+		k2 ^= uint64(item[i]) << (8 * uint(i-8))
+	}
+	if len(item) > 8 {
+		k2 *= murmurC2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+	}
+	for i := min(len(item), 8) - 1; i >= 0; i-- {
+		k1 ^= uint64(item[i]) << (8 * uint(i))
+	}
+	if len(item) > 0 {
+		k1 *= murmurC1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(n)
+	h2 ^= uint64(n)
+	h1 += h2
+	h2 += h1
+	h1 = murmurFmix(h1)
+	h2 = murmurFmix(h2)
+	h1 += h2
+	return h1
+}
+
+// locations derives a column for every row from a single hash, using the
+// double hashing scheme of Kirsch and Mitzenmacher: column(i) = l + i*u mod w
+type locations struct {
+	h, u, l, w uint64
+}
+
+func newLocations(h, w uint64) locations {
+	return locations{h: h, u: h >> 32, l: h & 0xFFFFFFFF, w: w}
+}
+
+func (l locations) column(row uint) uint64 {
+	return (l.u*uint64(row) + l.l) % l.w
+}
+
+// sign is the +1 or -1 a CountSketch multiplies the item's count by in row, it's
+// the top bit of the hash remixed with the row so rows get independent signs
+func (l locations) sign(row uint) int64 {
+	x := l.h ^ (uint64(row)+1)*0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return 1 - 2*int64((x^x>>31)>>63)
+}
@@ -0,0 +1,77 @@
+package cmsketch
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// ErrConservativeInnerProduct when CMSketch.InnerProduct is invoked on conservative update sketches
+var ErrConservativeInnerProduct = errors.New("cannot estimate the inner product of conservative update CMSketch objects")
+
+// InnerProduct estimates the sum over every item of its count in cms times its
+// count in other, the size of the join of the two streams. Each row gives an
+// estimate by multiplying the two sketches' counters column by column, CountMin
+// and CountMeanMin take the smallest, which never underestimates and exceeds the
+// true product by at most ErrorBound times the product of the streams' totals
+// with probability Confidence. CountSketch takes the median. The sketches must be
+// mergeable, see Merge for the errors returned when they aren't, and conservative
+// update sketches return ErrConservativeInnerProduct since their counters aren't
+// sums of counts. If the product overflows it returns ErrOverflow.
+func (cms *cmsketch) InnerProduct(other CMSketch) (uint64, error) {
+	theirs := other.snapshot()
+	cms.lock(false)
+	defer cms.unlock(false)
+
+	if err := cms.compatible(theirs); err != nil {
+		return 0, err
+	}
+	if cms.conservative {
+		return 0, ErrConservativeInnerProduct
+	}
+	if cms.estimator == CountSketch {
+		return cms.signedInnerProduct(theirs)
+	}
+
+	estimate := uint64(math.MaxUint64)
+	for r := uint(0); r < cms.d; r++ {
+		var sum uint64
+		for c := uint64(0); c < uint64(cms.w); c++ {
+			hi, product := bits.Mul64(cms.value(r, c), cms.decode(theirs.raw(r, c)))
+			var carry uint64
+			sum, carry = bits.Add64(sum, product, 0)
+			if hi != 0 || carry != 0 {
+				return 0, ErrOverflow
+			}
+		}
+		estimate = min(estimate, sum)
+	}
+	return estimate, nil
+}
+
+// signedInnerProduct is the median of every row's signed inner product, callers must hold the lock
+func (cms *cmsketch) signedInnerProduct(theirs *cmsketch) (uint64, error) {
+	var stack [maxStackDepth]int64
+	estimates := stack[:0]
+	for r := uint(0); r < cms.d; r++ {
+		var sum int64
+		for c := uint64(0); c < uint64(cms.w); c++ {
+			a, b := int64(cms.raw(r, c)), int64(theirs.raw(r, c))
+			product := a * b
+			if a != 0 && (product/a != b || (a == -1 && b == math.MinInt64)) {
+				return 0, ErrOverflow
+			}
+			if signedOverflows(sum, product) {
+				return 0, ErrOverflow
+			}
+			sum += product
+		}
+		estimates = append(estimates, sum)
+	}
+
+	median := medianOf(estimates)
+	if median < 0 {
+		return 0, nil
+	}
+	return uint64(median), nil
+}
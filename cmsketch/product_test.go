@@ -0,0 +1,108 @@
+package cmsketch
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestInnerProduct(t *testing.T) {
+	fmt.Println("TestInnerProduct")
+	cm1, _ := New(0.999, 0.001)
+	cm2, _ := New(0.999, 0.001)
+	cm1.Add([]byte("a"), 3)
+	cm1.Add([]byte("b"), 5)
+	cm1.Add([]byte("c"), 7)
+	cm2.Add([]byte("a"), 2)
+	cm2.Add([]byte("c"), 4)
+	cm2.Add([]byte("d"), 9)
+
+	product, err := cm1.InnerProduct(cm2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 3*2+7*4, product, "Inner product mismatched")
+
+	// a sketch's inner product with itself is the sum of squared counts
+	self, _ := cm1.InnerProduct(cm1)
+	assert(t, 9+25+49, self, "Self inner product mismatched")
+}
+
+func TestInnerProductBound(t *testing.T) {
+	fmt.Println("TestInnerProductBound")
+	left, right := zipf(50000, 2000), zipf(50000, 3000)
+	var expected, leftTotal, rightTotal uint64
+	for key, count := range left {
+		expected += count * right[key]
+		leftTotal += count
+	}
+	for _, count := range right {
+		rightTotal += count
+	}
+
+	for name, create := range map[string]func(float64, float64, ...Option) (CMSketch, error){
+		"count-min":      New,
+		"count-mean-min": NewCountMeanMin,
+		"count-sketch":   NewCountSketch,
+	} {
+		cm1, _ := create(0.999, 0.001)
+		cm2, _ := create(0.999, 0.001)
+		for key, count := range left {
+			cm1.Add([]byte(key), count)
+		}
+		for key, count := range right {
+			cm2.Add([]byte(key), count)
+		}
+
+		product, err := cm1.InnerProduct(cm2)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		bound := cm1.ErrorBound() * float64(leftTotal) * float64(rightTotal)
+		if math.Abs(float64(product)-float64(expected)) > bound {
+			t.Errorf("%s: inner product %d is further than %f from %d", name, product, bound, expected)
+		}
+		if name != "count-sketch" && product < expected {
+			t.Errorf("%s: inner product %d underestimates %d", name, product, expected)
+		}
+	}
+}
+
+func TestInnerProductIncompatible(t *testing.T) {
+	fmt.Println("TestInnerProductIncompatible")
+	cm := createTestCMSketch()
+	cases := []struct {
+		name  string
+		other func() CMSketch
+		err   error
+	}{
+		{"dimensions", func() CMSketch { o, _ := New(0.99, 0.01); return o }, ErrCannotMergeDifferentDimensions},
+		{"seed", func() CMSketch { o, _ := New(0.999, 0.001, WithSeed(1)); return o }, ErrCannotMergeDifferentHashes},
+		{"estimator", func() CMSketch { o, _ := NewCountSketch(0.999, 0.001); return o }, ErrCannotMergeDifferentEstimators},
+	}
+	for _, c := range cases {
+		if _, err := cm.InnerProduct(c.other()); err != c.err {
+			t.Errorf("%s: expected error [%v], got [%v] instead", c.name, c.err, err)
+		}
+	}
+
+	conservative, _ := New(0.99, 0.01, WithConservativeUpdate())
+	if _, err := conservative.InnerProduct(conservative); err != ErrConservativeInnerProduct {
+		t.Errorf("Expected error %s, got [%v] instead", ErrConservativeInnerProduct, err)
+	}
+}
+
+func TestInnerProductOverflow(t *testing.T) {
+	fmt.Println("TestInnerProductOverflow")
+	cm, _ := New(0.99, 0.01)
+	cm.Add([]byte("Alex"), math.MaxUint32+1)
+	if _, err := cm.InnerProduct(cm); err != ErrOverflow {
+		t.Errorf("Expected error %s, got [%v] instead", ErrOverflow, err)
+	}
+
+	cs, _ := NewCountSketch(0.99, 0.01)
+	cs.Add([]byte("Alex"), math.MaxUint32+1)
+	if _, err := cs.InnerProduct(cs); err != ErrOverflow {
+		t.Errorf("Expected error %s, got [%v] instead", ErrOverflow, err)
+	}
+}
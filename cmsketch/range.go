@@ -0,0 +1,260 @@
+package cmsketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrInvalidDomain when NewRangeSketch is given a domain other than 1 to 64 bits
+	ErrInvalidDomain = errors.New("domain must be between 1 and 64 bits")
+	// ErrOutOfDomain when a RangeSketch is given a value that doesn't fit in its domain
+	ErrOutOfDomain = errors.New("value is outside the RangeSketch's domain")
+	// ErrInvalidRange when RangeSketch.RangeCount is given a lo greater than hi
+	ErrInvalidRange = errors.New("range must have lo no greater than hi")
+	// ErrInvalidQuantile when RangeSketch.Quantile is given a quantile outside [0, 1]
+	ErrInvalidQuantile = errors.New("quantile must be between 0 and 1")
+	// ErrEmptyRangeSketch when RangeSketch.Quantile is invoked before anything was added
+	ErrEmptyRangeSketch = errors.New("RangeSketch is empty")
+)
+
+// RangeSketch counts values from the integer domain [0, 2^bits) and answers how
+// many fall in a range. It keeps a CMSketch for every dyadic level, level l counts
+// values by their top bits-l bits, so any range splits into at most two intervals
+// per level that are each a single point query. A range's estimate exceeds the
+// true count by at most 2 * bits * ErrorBound times the total, with the
+// confidence of every point query involved.
+type RangeSketch struct {
+	bits   uint
+	levels []*cmsketch
+	// total bounds every counter, so checking it is enough to rule out overflow
+	total uint64
+	mutex sync.RWMutex
+}
+
+// NewRangeSketch returns a RangeSketch over values of the given number of bits,
+// every level is created by New with delta, epsilon and opts
+func NewRangeSketch(bits uint, delta, epsilon float64, opts ...Option) (*RangeSketch, error) {
+	if bits < 1 || bits > 64 {
+		return nil, ErrInvalidDomain
+	}
+
+	rs := &RangeSketch{
+		bits:   bits,
+		levels: make([]*cmsketch, bits),
+	}
+	for l := range rs.levels {
+		cm, err := newSketch(CountMin, delta, epsilon, opts)
+		if err != nil {
+			return nil, err
+		}
+		rs.levels[l] = cm
+	}
+	return rs, nil
+}
+
+// Bits returns the number of bits of the RangeSketch's domain
+func (rs *RangeSketch) Bits() uint {
+	return rs.bits
+}
+
+// Total returns the total count of every value added
+func (rs *RangeSketch) Total() uint64 {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	return rs.total
+}
+
+// Add counts total more occurrences of value
+func (rs *RangeSketch) Add(value, total uint64) error {
+	if !rs.inDomain(value) {
+		return ErrOutOfDomain
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.total > math.MaxUint64-total {
+		return ErrOverflow
+	}
+	for l, cm := range rs.levels {
+		if err := cm.Add(key(value>>l), total); err != nil {
+			return err
+		}
+	}
+	rs.total += total
+	return nil
+}
+
+// Remove drops total occurrences of value, if any level can tell fewer than
+// total were added it returns ErrUnderflow and leaves the RangeSketch unchanged
+func (rs *RangeSketch) Remove(value, total uint64) error {
+	if !rs.inDomain(value) {
+		return ErrOutOfDomain
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.total < total {
+		return ErrUnderflow
+	}
+	for l, cm := range rs.levels {
+		if cm.Count(key(value>>l)) < total {
+			return ErrUnderflow
+		}
+	}
+	for l, cm := range rs.levels {
+		if err := cm.Remove(key(value>>l), total); err != nil {
+			return err
+		}
+	}
+	rs.total -= total
+	return nil
+}
+
+// Count returns the estimated count of a single value
+func (rs *RangeSketch) Count(value uint64) uint64 {
+	if !rs.inDomain(value) {
+		return 0
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	return rs.levels[0].Count(key(value))
+}
+
+// RangeCount returns the estimated count of values from lo to hi inclusive
+func (rs *RangeSketch) RangeCount(lo, hi uint64) (uint64, error) {
+	if lo > hi {
+		return 0, ErrInvalidRange
+	}
+	if !rs.inDomain(hi) {
+		return 0, ErrOutOfDomain
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	return rs.rangeCount(lo, hi), nil
+}
+
+// rangeCount walks up the levels taking the odd interval off either end of the
+// range until the ends meet, callers must hold the lock
+func (rs *RangeSketch) rangeCount(lo, hi uint64) uint64 {
+	var count uint64
+	for l := uint(0); l < rs.bits; l++ {
+		// the whole of this level is the whole domain above it
+		if lo == 0 && hi == rs.max()>>l {
+			return count + rs.total
+		}
+		if lo&1 == 1 {
+			count += rs.levels[l].Count(key(lo))
+			if lo == hi {
+				return count
+			}
+			lo++
+		}
+		if hi&1 == 0 {
+			count += rs.levels[l].Count(key(hi))
+			if hi == 0 {
+				return count
+			}
+			hi--
+		}
+		if lo > hi {
+			return count
+		}
+		lo, hi = lo>>1, hi>>1
+	}
+	return count
+}
+
+// Quantile returns the estimated smallest value whose rank, the count of values
+// up to and including it, is at least q times the total
+func (rs *RangeSketch) Quantile(q float64) (uint64, error) {
+	if !(q >= 0 && q <= 1) {
+		return 0, ErrInvalidQuantile
+	}
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	if rs.total == 0 {
+		return 0, ErrEmptyRangeSketch
+	}
+
+	rank := uint64(math.Ceil(q * float64(rs.total)))
+	rank = max(min(rank, rs.total), 1)
+
+	// descend from the top, going right whenever the left half holds too few
+	var prefix uint64
+	for l := int(rs.bits) - 1; l >= 0; l-- {
+		prefix <<= 1
+		left := rs.levels[l].Count(key(prefix))
+		if left < rank {
+			rank -= left
+			prefix |= 1
+		}
+	}
+	return prefix, nil
+}
+
+// Merge adds other's counts to rs, they must have the same domain and mergeable
+// levels, see CMSketch.Merge
+func (rs *RangeSketch) Merge(other *RangeSketch) error {
+	if rs.bits != other.bits {
+		return ErrCannotMergeDifferentDimensions
+	}
+	total, levels := other.snapshot()
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for l, cm := range rs.levels {
+		if err := cm.compatible(levels[l]); err != nil {
+			return err
+		}
+	}
+	if rs.total > math.MaxUint64-total {
+		return ErrOverflow
+	}
+	for l, cm := range rs.levels {
+		if err := cm.merge(levels[l]); err != nil {
+			return err
+		}
+	}
+	rs.total += total
+	return nil
+}
+
+// snapshot copies the total and every level under the read lock, so they agree
+// with each other and can be merged without holding both sketches' locks
+func (rs *RangeSketch) snapshot() (uint64, []*cmsketch) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	levels := make([]*cmsketch, len(rs.levels))
+	for l, cm := range rs.levels {
+		levels[l] = cm.snapshot()
+	}
+	return rs.total, levels
+}
+
+// max is the largest value in the domain
+func (rs *RangeSketch) max() uint64 {
+	return math.MaxUint64 >> (64 - rs.bits)
+}
+
+func (rs *RangeSketch) inDomain(value uint64) bool {
+	return value <= rs.max()
+}
+
+// key is a level's prefix as the bytes its CMSketch hashes
+func key(prefix uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, prefix)
+}
@@ -0,0 +1,219 @@
+package cmsketch
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestRangeSketchInvalid(t *testing.T) {
+	fmt.Println("TestRangeSketchInvalid")
+	for _, bits := range []uint{0, 65} {
+		if _, err := NewRangeSketch(bits, 0.99, 0.01); err != ErrInvalidDomain {
+			t.Errorf("bits:%d expected error %s, got [%v] instead", bits, ErrInvalidDomain, err)
+		}
+	}
+	if _, err := NewRangeSketch(8, 0, 0.01); err != ErrInvalidDelta {
+		t.Errorf("Expected error %s, got [%v] instead", ErrInvalidDelta, err)
+	}
+
+	rs, _ := NewRangeSketch(8, 0.99, 0.01)
+	if err := rs.Add(256, 1); err != ErrOutOfDomain {
+		t.Errorf("Expected error %s, got [%v] instead", ErrOutOfDomain, err)
+	}
+	if _, err := rs.RangeCount(5, 4); err != ErrInvalidRange {
+		t.Errorf("Expected error %s, got [%v] instead", ErrInvalidRange, err)
+	}
+	if _, err := rs.RangeCount(0, 256); err != ErrOutOfDomain {
+		t.Errorf("Expected error %s, got [%v] instead", ErrOutOfDomain, err)
+	}
+	if _, err := rs.Quantile(0.5); err != ErrEmptyRangeSketch {
+		t.Errorf("Expected error %s, got [%v] instead", ErrEmptyRangeSketch, err)
+	}
+	rs.Add(1, 1)
+	for _, q := range []float64{-0.1, 1.1, math.NaN()} {
+		if _, err := rs.Quantile(q); err != ErrInvalidQuantile {
+			t.Errorf("q:%f expected error %s, got [%v] instead", q, ErrInvalidQuantile, err)
+		}
+	}
+}
+
+func TestRangeSketchExact(t *testing.T) {
+	fmt.Println("TestRangeSketchExact")
+	// a small domain in wide sketches has no collisions, so every answer is exact
+	rs, _ := NewRangeSketch(6, 0.999, 0.001)
+	var counts [64]uint64
+	for v := uint64(0); v < 64; v++ {
+		counts[v] = v%7 + 1
+		rs.Add(v, counts[v])
+	}
+
+	for lo := uint64(0); lo < 64; lo++ {
+		var expected uint64
+		for hi := lo; hi < 64; hi++ {
+			expected += counts[hi]
+			actual, err := rs.RangeCount(lo, hi)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			assert(t, expected, actual, fmt.Sprintf("RangeCount(%d, %d) mismatched", lo, hi))
+		}
+	}
+	assert(t, counts[10], rs.Count(10), "Count mismatched")
+}
+
+func TestRangeSketchFullDomain(t *testing.T) {
+	fmt.Println("TestRangeSketchFullDomain")
+	rs, _ := NewRangeSketch(64, 0.99, 0.01)
+	rs.Add(0, 1)
+	rs.Add(math.MaxUint64, 2)
+	rs.Add(1<<40, 3)
+
+	cases := []struct {
+		lo, hi, expected uint64
+	}{
+		{0, math.MaxUint64, 6},
+		{0, 0, 1},
+		{math.MaxUint64, math.MaxUint64, 2},
+		{1, math.MaxUint64 - 1, 3},
+		{1 << 40, math.MaxUint64, 5},
+	}
+	for _, c := range cases {
+		actual, _ := rs.RangeCount(c.lo, c.hi)
+		assert(t, c.expected, actual, fmt.Sprintf("RangeCount(%d, %d) mismatched", c.lo, c.hi))
+	}
+}
+
+func TestRangeSketchAccuracy(t *testing.T) {
+	fmt.Println("TestRangeSketchAccuracy")
+	const bits = 16
+	rs, _ := NewRangeSketch(bits, 0.99, 0.001)
+	r := rand.New(rand.NewSource(3))
+	counts := make([]uint64, 1<<bits)
+	for i := 0; i < 100000; i++ {
+		v := uint64(r.Intn(1 << bits))
+		counts[v]++
+		rs.Add(v, 1)
+	}
+
+	bound := 2 * bits * rs.levels[0].ErrorBound() * float64(rs.Total())
+	for i := 0; i < 200; i++ {
+		lo := uint64(r.Intn(1 << bits))
+		hi := lo + uint64(r.Intn(1<<bits-int(lo)))
+		var expected uint64
+		for v := lo; v <= hi; v++ {
+			expected += counts[v]
+		}
+		actual, _ := rs.RangeCount(lo, hi)
+		if actual < expected || float64(actual-expected) > bound {
+			t.Errorf("RangeCount(%d, %d) is %d, expected %d within %f", lo, hi, actual, expected, bound)
+		}
+	}
+}
+
+func TestRangeSketchQuantile(t *testing.T) {
+	fmt.Println("TestRangeSketchQuantile")
+	rs, _ := NewRangeSketch(10, 0.999, 0.001)
+	for v := uint64(0); v < 1000; v++ {
+		rs.Add(v, 1)
+	}
+
+	cases := []struct {
+		q        float64
+		expected uint64
+	}{
+		{0, 0},
+		{0.001, 0},
+		{0.25, 249},
+		{0.5, 499},
+		{0.9, 899},
+		{1, 999},
+	}
+	for _, c := range cases {
+		actual, err := rs.Quantile(c.q)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		assert(t, c.expected, actual, fmt.Sprintf("Quantile(%f) mismatched", c.q))
+	}
+}
+
+func TestRangeSketchRemove(t *testing.T) {
+	fmt.Println("TestRangeSketchRemove")
+	rs, _ := NewRangeSketch(8, 0.999, 0.001)
+	rs.Add(10, 5)
+	rs.Add(200, 3)
+	if err := rs.Remove(10, 2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := rs.Remove(10, 4); err != ErrUnderflow {
+		t.Errorf("Expected error %s, got [%v] instead", ErrUnderflow, err)
+	}
+	actual, _ := rs.RangeCount(0, 255)
+	assert(t, 6, actual, "RangeCount mismatched after Remove")
+	actual, _ = rs.RangeCount(0, 100)
+	assert(t, 3, actual, "RangeCount mismatched after Remove")
+	assert(t, 6, rs.Total(), "Total mismatched after Remove")
+}
+
+func TestRangeSketchMerge(t *testing.T) {
+	fmt.Println("TestRangeSketchMerge")
+	rs1, _ := NewRangeSketch(8, 0.999, 0.001)
+	rs2, _ := NewRangeSketch(8, 0.999, 0.001)
+	rs1.Add(1, 2)
+	rs2.Add(1, 3)
+	rs2.Add(100, 4)
+	if err := rs1.Merge(rs2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	actual, _ := rs1.RangeCount(0, 50)
+	assert(t, 5, actual, "RangeCount mismatched after Merge")
+	assert(t, 9, rs1.Total(), "Total mismatched after Merge")
+
+	if err := rs1.Merge(rs1); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	actual, _ = rs1.RangeCount(50, 255)
+	assert(t, 8, actual, "RangeCount mismatched after merging with itself")
+
+	narrow, _ := NewRangeSketch(4, 0.999, 0.001)
+	if err := rs1.Merge(narrow); err != ErrCannotMergeDifferentDimensions {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentDimensions, err)
+	}
+	seeded, _ := NewRangeSketch(8, 0.999, 0.001, WithSeed(4))
+	if err := rs1.Merge(seeded); err != ErrCannotMergeDifferentHashes {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentHashes, err)
+	}
+}
+
+func TestRangeSketchParallelMerge(t *testing.T) {
+	fmt.Println("TestRangeSketchParallelMerge")
+	rs1, _ := NewRangeSketch(8, 0.999, 0.001)
+	rs2, _ := NewRangeSketch(8, 0.999, 0.001)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			rs2.Add(7, 1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := rs1.Merge(rs2); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+				return
+			}
+			// the total and levels are copied together, so they must agree
+			if actual, _ := rs1.RangeCount(0, 255); actual != rs1.Total() {
+				t.Errorf("RangeCount mismatched -- expected:[%d] actual:[%d]", rs1.Total(), actual)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
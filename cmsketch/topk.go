@@ -0,0 +1,235 @@
+package cmsketch
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrInvalidK when NewTopK is asked to track fewer than one item
+var ErrInvalidK = errors.New("k must be at least 1")
+
+// sequence hands out the ordering key used to lock two TopKs without deadlocking
+var sequence uint64
+
+// Entry is an item tracked by a TopK and its estimated count
+type Entry struct {
+	Item  []byte
+	Count uint64
+}
+
+// TopK tracks the k most frequent items of a stream. Counts are estimated by a
+// CMSketch and the current heavy hitters are kept in a min-heap, so an item is
+// only tracked once its estimate is larger than the smallest tracked count.
+type TopK struct {
+	k      int
+	sketch CMSketch
+	heap   topkHeap
+	index  map[string]*topkEntry
+	seq    uint64
+	mutex  sync.RWMutex
+}
+
+// NewTopK returns a TopK tracking k items, the sketch behind it is created with
+// New and the same parameters
+func NewTopK(k int, delta, epsilon float64, opts ...Option) (*TopK, error) {
+	if k < 1 {
+		return nil, ErrInvalidK
+	}
+	sketch, err := New(delta, epsilon, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopK{
+		k:      k,
+		sketch: sketch,
+		heap:   make(topkHeap, 0, k),
+		index:  make(map[string]*topkEntry, k),
+		seq:    atomic.AddUint64(&sequence, 1),
+	}, nil
+}
+
+// Add counts total more occurrences of item and returns its new estimated count
+func (t *TopK) Add(item []byte, total uint64) (uint64, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.sketch.Add(item, total); err != nil {
+		return 0, err
+	}
+	count := t.sketch.Count(item)
+	t.offer(string(item), count)
+	return count, nil
+}
+
+// Count returns the estimated count of item, whether it's tracked or not
+func (t *TopK) Count(item []byte) uint64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.sketch.Count(item)
+}
+
+// Contains is true if item is currently one of the k most frequent
+func (t *TopK) Contains(item []byte) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	_, exists := t.index[string(item)]
+	return exists
+}
+
+// K returns the number of items the TopK tracks
+func (t *TopK) K() int {
+	return t.k
+}
+
+// List returns the tracked items from the most to the least frequent, ties are
+// broken by the item's bytes so the order is stable
+func (t *TopK) List() []Entry {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	list := make([]Entry, 0, len(t.heap))
+	for _, e := range t.heap {
+		list = append(list, Entry{Item: []byte(e.item), Count: e.count})
+	}
+	slices.SortFunc(list, func(a, b Entry) int {
+		if a.Count != b.Count {
+			if a.Count > b.Count {
+				return -1
+			}
+			return 1
+		}
+		return bytes.Compare(a.Item, b.Item)
+	})
+	return list
+}
+
+// Merge adds other's counts to t. The heavy hitters of the union are among the
+// items either side tracked, they're re-estimated from the merged sketch and the
+// k largest are kept. The sketches must be mergeable, see CMSketch.Merge.
+func (t *TopK) Merge(other *TopK) error {
+	if t == other {
+		return t.mergeSelf()
+	}
+
+	if t.seq < other.seq {
+		t.mutex.Lock()
+		other.mutex.RLock()
+	} else {
+		other.mutex.RLock()
+		t.mutex.Lock()
+	}
+	defer t.mutex.Unlock()
+	defer other.mutex.RUnlock()
+
+	if err := t.sketch.Merge(other.sketch); err != nil {
+		return err
+	}
+	candidates := make([]string, 0, len(t.heap)+len(other.heap))
+	for _, e := range t.heap {
+		candidates = append(candidates, e.item)
+	}
+	for _, e := range other.heap {
+		candidates = append(candidates, e.item)
+	}
+	t.rebuild(candidates)
+	return nil
+}
+
+func (t *TopK) mergeSelf() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.sketch.Merge(t.sketch); err != nil {
+		return err
+	}
+	for _, e := range t.heap {
+		e.count = t.sketch.Count([]byte(e.item))
+	}
+	heap.Init(&t.heap)
+	return nil
+}
+
+// rebuild re-estimates every candidate and keeps the k largest, callers must hold the write lock
+func (t *TopK) rebuild(candidates []string) {
+	t.heap = t.heap[:0]
+	clear(t.index)
+	for _, item := range candidates {
+		if _, exists := t.index[item]; exists {
+			continue
+		}
+		t.offer(item, t.sketch.Count([]byte(item)))
+	}
+}
+
+// offer updates or starts tracking item if count makes it a heavy hitter
+func (t *TopK) offer(item string, count uint64) {
+	if e, exists := t.index[item]; exists {
+		e.count = count
+		heap.Fix(&t.heap, e.index)
+		return
+	}
+
+	if len(t.heap) < t.k {
+		e := &topkEntry{item: item, count: count}
+		t.index[item] = e
+		heap.Push(&t.heap, e)
+		return
+	}
+
+	smallest := t.heap[0]
+	if count <= smallest.count {
+		return
+	}
+	delete(t.index, smallest.item)
+	smallest.item, smallest.count = item, count
+	t.index[item] = smallest
+	heap.Fix(&t.heap, 0)
+}
+
+type topkEntry struct {
+	item  string
+	count uint64
+	index int
+}
+
+// topkHeap is a min-heap of entries by count, it implements heap.Interface
+type topkHeap []*topkEntry
+
+func (h topkHeap) Len() int {
+	return len(h)
+}
+
+func (h topkHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	// among equal counts evict the largest item first, matching List's order
+	return h[i].item > h[j].item
+}
+
+func (h topkHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topkHeap) Push(x any) {
+	e := x.(*topkEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *topkHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,113 @@
+package cmsketch
+
+import (
+	"fmt"
+	"testing"
+)
+
+func assertEntries(t *testing.T, expected, actual []Entry, msg string) {
+	if len(expected) != len(actual) {
+		t.Errorf("%s -- expected:%d entries actual:%d entries", msg, len(expected), len(actual))
+		return
+	}
+	for i := range expected {
+		if string(expected[i].Item) != string(actual[i].Item) || expected[i].Count != actual[i].Count {
+			t.Errorf("%s -- at %d expected:[%s:%d] actual:[%s:%d]", msg, i, expected[i].Item, expected[i].Count, actual[i].Item, actual[i].Count)
+		}
+	}
+}
+
+func TestTopKInvalid(t *testing.T) {
+	fmt.Println("TestTopKInvalid")
+	if _, err := NewTopK(0, 0.99, 0.001); err != ErrInvalidK {
+		t.Errorf("Expected error %s, got [%v] instead", ErrInvalidK, err)
+	}
+}
+
+func TestTopKList(t *testing.T) {
+	fmt.Println("TestTopKList")
+	tk, _ := NewTopK(3, 0.999, 0.001)
+	counts := map[string]uint64{"a": 10, "b": 50, "c": 5, "d": 30, "e": 1}
+	for _, item := range []string{"a", "b", "c", "d", "e"} {
+		for i := uint64(0); i < counts[item]; i++ {
+			tk.Add([]byte(item), 1)
+		}
+	}
+
+	expected := []Entry{{[]byte("b"), 50}, {[]byte("d"), 30}, {[]byte("a"), 10}}
+	assertEntries(t, expected, tk.List(), "List mismatched")
+	if tk.Contains([]byte("c")) || !tk.Contains([]byte("a")) {
+		t.Error("Expected a to be tracked and c not to be")
+	}
+	assert(t, 5, tk.Count([]byte("c")), "Count of untracked item mismatched")
+}
+
+func TestTopKPromotes(t *testing.T) {
+	fmt.Println("TestTopKPromotes")
+	tk, _ := NewTopK(2, 0.999, 0.001)
+	tk.Add([]byte("a"), 5)
+	tk.Add([]byte("b"), 4)
+	tk.Add([]byte("c"), 3)
+	assertEntries(t, []Entry{{[]byte("a"), 5}, {[]byte("b"), 4}}, tk.List(), "List mismatched before promotion")
+
+	count, err := tk.Add([]byte("c"), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assert(t, 6, count, "Count returned by Add mismatched")
+	assertEntries(t, []Entry{{[]byte("c"), 6}, {[]byte("a"), 5}}, tk.List(), "List mismatched after promotion")
+}
+
+func TestTopKTies(t *testing.T) {
+	fmt.Println("TestTopKTies")
+	tk, _ := NewTopK(2, 0.999, 0.001)
+	for _, item := range []string{"c", "b", "a"} {
+		tk.Add([]byte(item), 1)
+	}
+	assertEntries(t, []Entry{{[]byte("b"), 1}, {[]byte("c"), 1}}, tk.List(), "List mismatched")
+}
+
+func TestTopKMerge(t *testing.T) {
+	fmt.Println("TestTopKMerge")
+	tk1, _ := NewTopK(2, 0.999, 0.001)
+	tk2, _ := NewTopK(2, 0.999, 0.001)
+	tk1.Add([]byte("a"), 10)
+	tk1.Add([]byte("b"), 8)
+	tk1.Add([]byte("c"), 7)
+	tk2.Add([]byte("c"), 7)
+	tk2.Add([]byte("d"), 9)
+
+	if err := tk1.Merge(tk2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assertEntries(t, []Entry{{[]byte("c"), 14}, {[]byte("a"), 10}}, tk1.List(), "List mismatched after merge")
+	assertEntries(t, []Entry{{[]byte("d"), 9}, {[]byte("c"), 7}}, tk2.List(), "Merge modified its argument")
+
+	if err := tk2.Merge(tk2); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assertEntries(t, []Entry{{[]byte("d"), 18}, {[]byte("c"), 14}}, tk2.List(), "List mismatched after merging with itself")
+}
+
+func TestTopKMergeIncompatible(t *testing.T) {
+	fmt.Println("TestTopKMergeIncompatible")
+	tk1, _ := NewTopK(2, 0.999, 0.001)
+	tk2, _ := NewTopK(2, 0.999, 0.001, WithSeed(1))
+	if err := tk1.Merge(tk2); err != ErrCannotMergeDifferentHashes {
+		t.Errorf("Expected error %s, got [%v] instead", ErrCannotMergeDifferentHashes, err)
+	}
+}
+
+func TestTopKZipf(t *testing.T) {
+	fmt.Println("TestTopKZipf")
+	tk, _ := NewTopK(5, 0.999, 0.001)
+	// item i appears 1000/i times, so the top five are 1 through 5
+	for i := 1; i <= 200; i++ {
+		tk.Add([]byte(fmt.Sprintf("item-%d", i)), uint64(1000/i))
+	}
+	for i, e := range tk.List() {
+		if expected := fmt.Sprintf("item-%d", i+1); string(e.Item) != expected {
+			t.Errorf("Expected %s at %d, got %s", expected, i, e.Item)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cmsketch
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrInvalidWindow when NewWindowed is given a window that can't be split into the buckets asked for
+var ErrInvalidWindow = errors.New("window must be positive and at least a nanosecond per bucket")
+
+// Clock returns the current time, Windowed takes one so tests can control time
+type Clock func() time.Time
+
+// Windowed counts items over a sliding window of time. The window is split into
+// buckets, each a CMSketch covering an equal span of time, kept in a ring that
+// reuses the oldest bucket once it has left the window. An item is counted for
+// at least the window and at most the window plus one bucket's span after it's
+// added, more buckets make that boundary sharper but cost more memory.
+type Windowed struct {
+	window  time.Duration
+	span    int64
+	clock   Clock
+	buckets []*cmsketch
+	// ids is the bucket number, time divided by span, each slot of the ring holds
+	ids    []int64
+	latest int64
+	mutex  sync.RWMutex
+}
+
+// NewWindowed returns a Windowed counting over window with the given number of
+// buckets, each created by New with delta, epsilon and opts. The clock defaults
+// to time.Now if it's nil.
+func NewWindowed(window time.Duration, buckets int, clock Clock, delta, epsilon float64, opts ...Option) (*Windowed, error) {
+	if window <= 0 || buckets < 1 || int64(window) < int64(buckets) {
+		return nil, ErrInvalidWindow
+	}
+	if clock == nil {
+		clock = time.Now
+	}
+
+	// one more bucket than asked for, so the one being filled doesn't cut the window short
+	wd := &Windowed{
+		window:  window,
+		span:    int64(window) / int64(buckets),
+		clock:   clock,
+		buckets: make([]*cmsketch, buckets+1),
+		ids:     make([]int64, buckets+1),
+		latest:  math.MinInt64,
+	}
+	for i := range wd.buckets {
+		cm, err := newSketch(CountMin, delta, epsilon, opts)
+		if err != nil {
+			return nil, err
+		}
+		wd.buckets[i] = cm
+		wd.ids[i] = math.MinInt64
+	}
+	return wd, nil
+}
+
+// Add places an item into the bucket for the current time
+func (wd *Windowed) Add(item []byte, total uint64) error {
+	wd.mutex.Lock()
+	defer wd.mutex.Unlock()
+
+	// a clock that goes backwards keeps adding to the latest bucket
+	id := max(wd.bucketID(), wd.latest)
+	slot := wd.slot(id)
+	if wd.ids[slot] != id {
+		wd.buckets[slot].reset()
+		wd.ids[slot] = id
+	}
+	wd.latest = id
+
+	return wd.buckets[slot].Add(item, total)
+}
+
+// Count returns the count of the item over the window, the sum of its count in
+// every bucket still in the window
+func (wd *Windowed) Count(item []byte) uint64 {
+	wd.mutex.RLock()
+	defer wd.mutex.RUnlock()
+
+	var count uint64
+	for slot := range wd.buckets {
+		if wd.live(slot) {
+			count += wd.buckets[slot].Count(item)
+		}
+	}
+	return count
+}
+
+// Window returns the duration the Windowed counts over
+func (wd *Windowed) Window() time.Duration {
+	return wd.window
+}
+
+// Buckets returns the number of buckets the window is split into
+func (wd *Windowed) Buckets() int {
+	return len(wd.buckets) - 1
+}
+
+// bucketID is the number of the bucket the clock's time falls in
+func (wd *Windowed) bucketID() int64 {
+	now := wd.clock().UnixNano()
+	id := now / wd.span
+	if now < 0 && now%wd.span != 0 {
+		id--
+	}
+	return id
+}
+
+func (wd *Windowed) slot(id int64) int {
+	n := int64(len(wd.buckets))
+	return int(((id % n) + n) % n)
+}
+
+// live is true if the bucket in slot is still in the window, callers must hold the lock
+func (wd *Windowed) live(slot int) bool {
+	if wd.ids[slot] == math.MinInt64 {
+		return false
+	}
+	now := max(wd.bucketID(), wd.latest)
+	return wd.ids[slot] > now-int64(len(wd.buckets))
+}
+
+// reset zeroes every counter
+func (cms *cmsketch) reset() {
+	cms.lock(true)
+	defer cms.unlock(true)
+
+	clear(cms.cells)
+	cms.total = 0
+}
@@ -0,0 +1,117 @@
+package cmsketch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func createTestWindowed(clock *fakeClock) *Windowed {
+	wd, _ := NewWindowed(10*time.Minute, 10, clock.Now, 0.999, 0.001)
+	return wd
+}
+
+func TestWindowedInvalid(t *testing.T) {
+	fmt.Println("TestWindowedInvalid")
+	cases := []struct {
+		window  time.Duration
+		buckets int
+	}{
+		{0, 1},
+		{-time.Second, 1},
+		{time.Minute, 0},
+		{5 * time.Nanosecond, 6},
+	}
+
+	for _, c := range cases {
+		if _, err := NewWindowed(c.window, c.buckets, nil, 0.99, 0.01); err != ErrInvalidWindow {
+			t.Errorf("window:%s buckets:%d expected error %s, got [%v] instead", c.window, c.buckets, ErrInvalidWindow, err)
+		}
+	}
+	if _, err := NewWindowed(time.Minute, 6, nil, 0.99, 0.01, WithHash(HashFamily(0))); err != ErrUnknownHashFamily {
+		t.Errorf("Expected error %s, got [%v] instead", ErrUnknownHashFamily, err)
+	}
+}
+
+func TestWindowedCount(t *testing.T) {
+	fmt.Println("TestWindowedCount")
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	wd := createTestWindowed(clock)
+
+	wd.Add([]byte("Alex"), 1)
+	clock.Advance(3 * time.Minute)
+	wd.Add([]byte("Alex"), 2)
+	clock.Advance(3 * time.Minute)
+	wd.Add([]byte("Alex"), 4)
+	assert(t, 7, wd.Count([]byte("Alex")), "Count mismatched inside the window")
+
+	clock.Advance(5 * time.Minute)
+	assert(t, 6, wd.Count([]byte("Alex")), "Count mismatched after the first add left the window")
+	clock.Advance(3 * time.Minute)
+	assert(t, 4, wd.Count([]byte("Alex")), "Count mismatched after the second add left the window")
+	clock.Advance(10 * time.Minute)
+	assert(t, 0, wd.Count([]byte("Alex")), "Count mismatched after everything left the window")
+}
+
+func TestWindowedBoundary(t *testing.T) {
+	fmt.Println("TestWindowedBoundary")
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	wd := createTestWindowed(clock)
+	wd.Add([]byte("Alex"), 1)
+
+	// counted for at least the window, and gone within one more bucket
+	clock.Advance(10*time.Minute - time.Nanosecond)
+	assert(t, 1, wd.Count([]byte("Alex")), "Count dropped before the window ended")
+	clock.Advance(time.Minute + time.Nanosecond)
+	assert(t, 0, wd.Count([]byte("Alex")), "Count kept after the window and a bucket")
+}
+
+func TestWindowedReusesBuckets(t *testing.T) {
+	fmt.Println("TestWindowedReusesBuckets")
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	wd := createTestWindowed(clock)
+
+	// every add lands in a reused bucket after the first lap of the ring
+	for i := 0; i < 100; i++ {
+		wd.Add([]byte("Alex"), 1)
+		clock.Advance(time.Minute)
+	}
+	clock.Advance(-time.Minute)
+	assert(t, 11, wd.Count([]byte("Alex")), "Count mismatched after many laps")
+}
+
+func TestWindowedClockBackwards(t *testing.T) {
+	fmt.Println("TestWindowedClockBackwards")
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	wd := createTestWindowed(clock)
+	wd.Add([]byte("Alex"), 1)
+	clock.Advance(-time.Hour)
+	wd.Add([]byte("Alex"), 1)
+	assert(t, 2, wd.Count([]byte("Alex")), "Count mismatched after the clock went backwards")
+}
+
+func TestWindowedDefaultClock(t *testing.T) {
+	fmt.Println("TestWindowedDefaultClock")
+	wd, err := NewWindowed(time.Hour, 4, nil, 0.99, 0.01)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	wd.Add([]byte("Alex"), 3)
+	assert(t, 3, wd.Count([]byte("Alex")), "Count mismatched")
+	if wd.Window() != time.Hour || wd.Buckets() != 4 {
+		t.Errorf("Expected a 1h window in 4 buckets, got %s in %d", wd.Window(), wd.Buckets())
+	}
+}
@@ -0,0 +1,159 @@
+package set
+
+// node is an AVL tree node augmented with the size of its subtree, which
+// allows rank and select queries in O(log n)
+type node struct {
+	item        Item
+	left, right *node
+	height      int
+	size        int
+}
+
+func newNode(item Item) *node {
+	return &node{item: item, height: 1, size: 1}
+}
+
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func size(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *node) update() {
+	n.height = 1 + max(height(n.left), height(n.right))
+	n.size = 1 + size(n.left) + size(n.right)
+}
+
+func (n *node) balance() int {
+	return height(n.left) - height(n.right)
+}
+
+func rotateRight(n *node) *node {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	n.update()
+	l.update()
+	return l
+}
+
+func rotateLeft(n *node) *node {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	n.update()
+	r.update()
+	return r
+}
+
+func rebalance(n *node) *node {
+	n.update()
+	switch b := n.balance(); {
+	case b > 1:
+		if n.left.balance() < 0 {
+			n.left = rotateLeft(n.left)
+		}
+		return rotateRight(n)
+	case b < -1:
+		if n.right.balance() > 0 {
+			n.right = rotateRight(n.right)
+		}
+		return rotateLeft(n)
+	}
+	return n
+}
+
+// insert adds item to the tree rooted at n, inserted is false if an equal item was already there
+func insert(n *node, item Item, comp Comparator) (root *node, inserted bool) {
+	if n == nil {
+		return newNode(item), true
+	}
+
+	switch c := comp(item, n.item); {
+	case c < equal:
+		n.left, inserted = insert(n.left, item, comp)
+	case c > equal:
+		n.right, inserted = insert(n.right, item, comp)
+	default:
+		return n, false
+	}
+	if !inserted {
+		return n, false
+	}
+	return rebalance(n), true
+}
+
+// remove deletes the item equal to item from the tree rooted at n
+func remove(n *node, item Item, comp Comparator) (root *node, removed bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	switch c := comp(item, n.item); {
+	case c < equal:
+		n.left, removed = remove(n.left, item, comp)
+	case c > equal:
+		n.right, removed = remove(n.right, item, comp)
+	default:
+		if n.left == nil {
+			return n.right, true
+		}
+		if n.right == nil {
+			return n.left, true
+		}
+		successor := n.right
+		for successor.left != nil {
+			successor = successor.left
+		}
+		n.item = successor.item
+		n.right, _ = remove(n.right, successor.item, comp)
+		removed = true
+	}
+	if !removed {
+		return n, false
+	}
+	return rebalance(n), true
+}
+
+// ascend calls fn on every item of the tree in ascending order until fn returns false
+func ascend(n *node, fn func(Item) bool) bool {
+	if n == nil {
+		return true
+	}
+	return ascend(n.left, fn) && fn(n.item) && ascend(n.right, fn)
+}
+
+// descend calls fn on every item of the tree in descending order until fn returns false
+func descend(n *node, fn func(Item) bool) bool {
+	if n == nil {
+		return true
+	}
+	return descend(n.right, fn) && fn(n.item) && descend(n.left, fn)
+}
+
+// ascendRange calls fn on every item between lo and hi inclusive in ascending order
+func ascendRange(n *node, lo, hi Item, comp Comparator, fn func(Item) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	aboveLo, belowHi := comp(n.item, lo) >= equal, comp(n.item, hi) <= equal
+	if aboveLo && !ascendRange(n.left, lo, hi, comp, fn) {
+		return false
+	}
+	if aboveLo && belowHi && !fn(n.item) {
+		return false
+	}
+	if belowHi {
+		return ascendRange(n.right, lo, hi, comp, fn)
+	}
+	return true
+}
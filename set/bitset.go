@@ -0,0 +1,410 @@
+package set
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"iter"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Unsigned is the type of the members of a Bitset. It's limited to 32 bits so
+// the words holding every possible member fit in 512 MiB.
+type Unsigned interface {
+	~uint32
+}
+
+// maxWords is the number of words holding every possible member of a Bitset
+const maxWords = 1 << 26
+
+// Bitset is a set of integers stored one bit per possible member. It's meant for
+// dense domains like user or shard IDs, the memory it uses is proportional to
+// the largest member, not to the number of members. Roaring is smaller for
+// sparse uint32 members, and uint64 IDs, which neither can hold, belong in a Set.
+//
+// Like Set it's safe for concurrent use, operations on two Bitsets read lock
+// both in a global order so they can't deadlock each other.
+type Bitset[T Unsigned] struct {
+	mutex sync.RWMutex
+	words []uint64
+	count int
+	seq   uint64
+}
+
+// NewBitset returns an empty Bitset
+func NewBitset[T Unsigned]() *Bitset[T] {
+	return &Bitset[T]{seq: atomic.AddUint64(&sequence, 1)}
+}
+
+// NewBitsetOf returns a Bitset containing values
+func NewBitsetOf[T Unsigned](values ...T) *Bitset[T] {
+	b := NewBitset[T]()
+	for _, v := range values {
+		b.add(v)
+	}
+	return b
+}
+
+func (b *Bitset[T]) lock(write bool) {
+	if write {
+		b.mutex.Lock()
+		return
+	}
+
+	b.mutex.RLock()
+}
+
+func (b *Bitset[T]) unlock(write bool) {
+	if write {
+		b.mutex.Unlock()
+		return
+	}
+
+	b.mutex.RUnlock()
+}
+
+// lockBitsets takes the lock on b (write or read) and a read lock on other in
+// ascending sequence, it returns the function releasing them
+func (b *Bitset[T]) lockBitsets(write bool, other *Bitset[T]) func() {
+	if b == other {
+		b.lock(write)
+		return func() { b.unlock(write) }
+	}
+
+	if b.seq < other.seq {
+		b.lock(write)
+		other.lock(false)
+	} else {
+		other.lock(false)
+		b.lock(write)
+	}
+	return func() {
+		other.unlock(false)
+		b.unlock(write)
+	}
+}
+
+func position(v uint64) (int, uint64) {
+	return int(v >> 6), 1 << (v & 63)
+}
+
+func (b *Bitset[T]) add(v T) bool {
+	w, mask := position(uint64(v))
+	if w >= len(b.words) {
+		b.words = append(b.words, make([]uint64, w+1-len(b.words))...)
+	}
+	if b.words[w]&mask != 0 {
+		return false
+	}
+	b.words[w] |= mask
+	b.count++
+	return true
+}
+
+// Add puts v in the set, returning false if it was already there
+func (b *Bitset[T]) Add(v T) bool {
+	b.lock(true)
+	defer b.unlock(true)
+
+	return b.add(v)
+}
+
+// Remove takes v out of the set, returning false if it wasn't there
+func (b *Bitset[T]) Remove(v T) bool {
+	b.lock(true)
+	defer b.unlock(true)
+
+	w, mask := position(uint64(v))
+	if w >= len(b.words) || b.words[w]&mask == 0 {
+		return false
+	}
+	b.words[w] &^= mask
+	b.count--
+	return true
+}
+
+// Contains is true if v is in the set
+func (b *Bitset[T]) Contains(v T) bool {
+	b.lock(false)
+	defer b.unlock(false)
+
+	w, mask := position(uint64(v))
+	return w < len(b.words) && b.words[w]&mask != 0
+}
+
+// Empty removes every member and releases the memory
+func (b *Bitset[T]) Empty() {
+	b.lock(true)
+	defer b.unlock(true)
+
+	b.words = nil
+	b.count = 0
+}
+
+// Size returns the number of members, the population count of the bitset
+func (b *Bitset[T]) Size() int {
+	b.lock(false)
+	defer b.unlock(false)
+
+	return b.count
+}
+
+// NextSet returns the smallest member greater than or equal to from
+func (b *Bitset[T]) NextSet(from T) (T, bool) {
+	b.lock(false)
+	defer b.unlock(false)
+
+	w, _ := position(uint64(from))
+	if w >= len(b.words) {
+		return 0, false
+	}
+	word := b.words[w] >> (uint64(from) & 63) << (uint64(from) & 63)
+	for {
+		if word != 0 {
+			return T(uint64(w)<<6 | uint64(bits.TrailingZeros64(word))), true
+		}
+		w++
+		if w == len(b.words) {
+			return 0, false
+		}
+		word = b.words[w]
+	}
+}
+
+// PrevSet returns the largest member less than or equal to from
+func (b *Bitset[T]) PrevSet(from T) (T, bool) {
+	b.lock(false)
+	defer b.unlock(false)
+
+	if len(b.words) == 0 {
+		return 0, false
+	}
+	w, _ := position(uint64(from))
+	word := b.words[len(b.words)-1]
+	if w < len(b.words) {
+		shift := 63 - uint64(from)&63
+		word = b.words[w] << shift >> shift
+	} else {
+		w = len(b.words) - 1
+	}
+	for {
+		if word != 0 {
+			return T(uint64(w)<<6 | uint64(63-bits.LeadingZeros64(word))), true
+		}
+		if w == 0 {
+			return 0, false
+		}
+		w--
+		word = b.words[w]
+	}
+}
+
+// All iterates the members in ascending order over a snapshot of the set
+func (b *Bitset[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		b.lock(false)
+		words := append([]uint64(nil), b.words...)
+		b.unlock(false)
+
+		for w, word := range words {
+			for word != 0 {
+				v := uint64(w)<<6 | uint64(bits.TrailingZeros64(word))
+				if !yield(T(v)) {
+					return
+				}
+				word &= word - 1
+			}
+		}
+	}
+}
+
+// combine builds a new Bitset from b and other a word at a time
+func (b *Bitset[T]) combine(other *Bitset[T], op func(x, y uint64) uint64) *Bitset[T] {
+	defer b.lockBitsets(false, other)()
+
+	n := max(len(b.words), len(other.words))
+	result := NewBitset[T]()
+	result.words = make([]uint64, n)
+	for i := range result.words {
+		result.words[i] = op(word(b.words, i), word(other.words, i))
+		result.count += bits.OnesCount64(result.words[i])
+	}
+	result.trim()
+	return result
+}
+
+// combineWith applies op to b and other a word at a time in place, returning the change in size
+func (b *Bitset[T]) combineWith(other *Bitset[T], op func(x, y uint64) uint64) int {
+	defer b.lockBitsets(true, other)()
+
+	if len(other.words) > len(b.words) {
+		b.words = append(b.words, make([]uint64, len(other.words)-len(b.words))...)
+	}
+	before := b.count
+	b.count = 0
+	for i := range b.words {
+		b.words[i] = op(b.words[i], word(other.words, i))
+		b.count += bits.OnesCount64(b.words[i])
+	}
+	b.trim()
+	if b.count > before {
+		return b.count - before
+	}
+	return before - b.count
+}
+
+func word(words []uint64, i int) uint64 {
+	if i < len(words) {
+		return words[i]
+	}
+	return 0
+}
+
+// trim drops trailing zero words so the set doesn't hold on to memory it doesn't need
+func (b *Bitset[T]) trim() {
+	n := len(b.words)
+	for n > 0 && b.words[n-1] == 0 {
+		n--
+	}
+	b.words = b.words[:n]
+}
+
+func or(x, y uint64) uint64     { return x | y }
+func and(x, y uint64) uint64    { return x & y }
+func andNot(x, y uint64) uint64 { return x &^ y }
+
+// Union returns a new Bitset with the members of both b and other
+func (b *Bitset[T]) Union(other *Bitset[T]) *Bitset[T] {
+	return b.combine(other, or)
+}
+
+// Intersection returns a new Bitset with the members common to b and other
+func (b *Bitset[T]) Intersection(other *Bitset[T]) *Bitset[T] {
+	return b.combine(other, and)
+}
+
+// Difference returns a new Bitset with the members of b that aren't in other
+func (b *Bitset[T]) Difference(other *Bitset[T]) *Bitset[T] {
+	return b.combine(other, andNot)
+}
+
+// UnionWith adds every member of other and returns how many were added
+func (b *Bitset[T]) UnionWith(other *Bitset[T]) int {
+	return b.combineWith(other, or)
+}
+
+// IntersectWith removes every member that isn't in other and returns how many were removed
+func (b *Bitset[T]) IntersectWith(other *Bitset[T]) int {
+	return b.combineWith(other, and)
+}
+
+// DifferenceWith removes every member of other and returns how many were removed
+func (b *Bitset[T]) DifferenceWith(other *Bitset[T]) int {
+	return b.combineWith(other, andNot)
+}
+
+// Equal returns true if b and other have the same members
+func (b *Bitset[T]) Equal(other *Bitset[T]) bool {
+	defer b.lockBitsets(false, other)()
+
+	if b.count != other.count {
+		return false
+	}
+	return containsWords(b.words, other.words)
+}
+
+// Subset determines if other is a subset of b
+func (b *Bitset[T]) Subset(other *Bitset[T]) bool {
+	defer b.lockBitsets(false, other)()
+
+	return containsWords(b.words, other.words)
+}
+
+// Superset determines if other is a super set of b
+func (b *Bitset[T]) Superset(other *Bitset[T]) bool {
+	defer b.lockBitsets(false, other)()
+
+	return containsWords(other.words, b.words)
+}
+
+// containsWords is true if every bit set in inner is set in outer
+func containsWords(outer, inner []uint64) bool {
+	for i, w := range inner {
+		if w&^word(outer, i) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the bitset as a version byte, the number of words as a
+// uvarint and then the words in little endian
+func (b *Bitset[T]) MarshalBinary() ([]byte, error) {
+	b.lock(false)
+	defer b.unlock(false)
+
+	n := len(b.words)
+	for n > 0 && b.words[n-1] == 0 {
+		n--
+	}
+	buf := binary.AppendUvarint([]byte{binaryVersion}, uint64(n))
+	for _, w := range b.words[:n] {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the members of the bitset with ones written by MarshalBinary
+func (b *Bitset[T]) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return ErrInvalidEncoding
+	}
+	if data[0] != binaryVersion {
+		return ErrUnsupportedVersion
+	}
+	n, read := binary.Uvarint(data[1:])
+	data = data[1+max(read, 0):]
+	if read <= 0 || n != uint64(len(data))/8 || len(data)%8 != 0 || n > maxWords {
+		return ErrInvalidEncoding
+	}
+
+	words := make([]uint64, n)
+	count := 0
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(data[8*i:])
+		count += bits.OnesCount64(words[i])
+	}
+
+	b.lock(true)
+	defer b.unlock(true)
+
+	b.words, b.count = words, count
+	return nil
+}
+
+// MarshalJSON encodes the members as a JSON array of numbers
+func (b *Bitset[T]) MarshalJSON() ([]byte, error) {
+	members := make([]T, 0, b.Size())
+	for v := range b.All() {
+		members = append(members, v)
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON replaces the members of the bitset with a JSON array of numbers
+func (b *Bitset[T]) UnmarshalJSON(data []byte) error {
+	var members []T
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	b.lock(true)
+	defer b.unlock(true)
+
+	b.words, b.count = nil, 0
+	for _, v := range members {
+		b.add(v)
+	}
+	return nil
+}
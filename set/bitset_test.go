@@ -0,0 +1,189 @@
+package set
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func bitsetMembers[T Unsigned](b *Bitset[T]) []int {
+	var members []int
+	for v := range b.All() {
+		members = append(members, int(v))
+	}
+	return members
+}
+
+func TestBitsetAddRemove(t *testing.T) {
+	fmt.Println("TestBitsetAddRemove")
+	b := NewBitset[uint32]()
+	assertOperation(t, "add 1", b.Add(1), true)
+	assertOperation(t, "add 1 again", b.Add(1), false)
+	assertOperation(t, "add 64", b.Add(64), true)
+	assertOperation(t, "add 1000", b.Add(1000), true)
+	assertOperation(t, "contains 64", b.Contains(64), true)
+	assertOperation(t, "contains 65", b.Contains(65), false)
+	assertOperation(t, "contains past the end", b.Contains(1<<20), false)
+	if b.Size() != 3 {
+		t.Errorf("Expected size = 3, instead got %d", b.Size())
+	}
+	assertIntsEqual(t, "members", []int{1, 64, 1000}, bitsetMembers(b))
+
+	assertOperation(t, "remove 64", b.Remove(64), true)
+	assertOperation(t, "remove 64 again", b.Remove(64), false)
+	assertOperation(t, "remove past the end", b.Remove(1<<20), false)
+	assertIntsEqual(t, "members after remove", []int{1, 1000}, bitsetMembers(b))
+
+	b.Empty()
+	if b.Size() != 0 || len(bitsetMembers(b)) != 0 {
+		t.Errorf("Expected an empty bitset after Empty()")
+	}
+}
+
+func TestBitsetNextPrevSet(t *testing.T) {
+	fmt.Println("TestBitsetNextPrevSet")
+	b := NewBitsetOf[uint32](3, 63, 64, 200)
+	var tests = []struct {
+		from             uint32
+		next, prev       uint32
+		hasNext, hasPrev bool
+	}{
+		{0, 3, 0, true, false},
+		{3, 3, 3, true, true},
+		{4, 63, 3, true, true},
+		{64, 64, 64, true, true},
+		{65, 200, 64, true, true},
+		{201, 0, 200, false, true},
+		{100000, 0, 200, false, true},
+	}
+	for i, test := range tests {
+		next, found := b.NextSet(test.from)
+		if found != test.hasNext || next != test.next {
+			t.Errorf("Case %d failed, expected next %d %t, got %d %t", i+1, test.next, test.hasNext, next, found)
+		}
+		prev, found := b.PrevSet(test.from)
+		if found != test.hasPrev || prev != test.prev {
+			t.Errorf("Case %d failed, expected prev %d %t, got %d %t", i+1, test.prev, test.hasPrev, prev, found)
+		}
+	}
+	if _, found := NewBitset[uint32]().PrevSet(10); found {
+		t.Errorf("Did not expect an empty bitset to have a previous member")
+	}
+}
+
+func TestBitsetOperations(t *testing.T) {
+	fmt.Println("TestBitsetOperations")
+	b1, b2 := NewBitsetOf[uint32](1, 2, 3, 100, 200), NewBitsetOf[uint32](2, 3, 4, 300)
+	assertIntsEqual(t, "union", []int{1, 2, 3, 4, 100, 200, 300}, bitsetMembers(b1.Union(b2)))
+	assertIntsEqual(t, "intersection", []int{2, 3}, bitsetMembers(b1.Intersection(b2)))
+	assertIntsEqual(t, "difference", []int{1, 100, 200}, bitsetMembers(b1.Difference(b2)))
+	assertIntsEqual(t, "reverse difference", []int{4, 300}, bitsetMembers(b2.Difference(b1)))
+	if size := b1.Intersection(b2).Size(); size != 2 {
+		t.Errorf("Expected intersection size 2, got %d", size)
+	}
+
+	assertOperation(t, "union with adds 2", b1.UnionWith(b2) == 2, true)
+	assertOperation(t, "difference with removes 4", b1.DifferenceWith(b2) == 4, true)
+	assertIntsEqual(t, "after difference with", []int{1, 100, 200}, bitsetMembers(b1))
+	assertOperation(t, "intersect with removes 2", b1.IntersectWith(NewBitsetOf[uint32](100)) == 2, true)
+	assertIntsEqual(t, "after intersect with", []int{100}, bitsetMembers(b1))
+	assertOperation(t, "union with self adds nothing", b1.UnionWith(b1) == 0, true)
+}
+
+func TestBitsetRelations(t *testing.T) {
+	fmt.Println("TestBitsetRelations")
+	var tests = []struct {
+		b1, b2                  *Bitset[uint32]
+		equal, subset, superset bool
+	}{
+		{NewBitsetOf[uint32](1, 2), NewBitsetOf[uint32](1, 2), true, true, true},
+		{NewBitsetOf[uint32](1, 2, 500), NewBitsetOf[uint32](1, 2), false, true, false},
+		{NewBitsetOf[uint32](1, 2), NewBitsetOf[uint32](1, 2, 500), false, false, true},
+		{NewBitsetOf[uint32](1, 2), NewBitsetOf[uint32](3), false, false, false},
+		{NewBitsetOf[uint32](), NewBitsetOf[uint32](), true, true, true},
+	}
+	for i, test := range tests {
+		if test.b1.Equal(test.b2) != test.equal {
+			t.Errorf("Case %d failed, expected equal %t", i+1, test.equal)
+		}
+		if test.b1.Subset(test.b2) != test.subset {
+			t.Errorf("Case %d failed, expected subset %t", i+1, test.subset)
+		}
+		if test.b1.Superset(test.b2) != test.superset {
+			t.Errorf("Case %d failed, expected superset %t", i+1, test.superset)
+		}
+	}
+
+	// a removed high member leaves trailing zero words behind
+	b := NewBitsetOf[uint32](1, 1000)
+	b.Remove(1000)
+	assertOperation(t, "equal ignores trailing empty words", b.Equal(NewBitsetOf[uint32](1)), true)
+}
+
+func TestBitsetRandom(t *testing.T) {
+	fmt.Println("TestBitsetRandom")
+	r := rand.New(rand.NewSource(1))
+	b1, b2 := NewBitset[uint32](), NewBitset[uint32]()
+	r1, r2 := make(map[int]bool), make(map[int]bool)
+	for i := 0; i < 2000; i++ {
+		v1, v2 := r.Intn(5000), r.Intn(5000)
+		b1.Add(uint32(v1))
+		b2.Add(uint32(v2))
+		r1[v1], r2[v2] = true, true
+	}
+
+	var union, intersection, difference []int
+	for v := 0; v < 5000; v++ {
+		if r1[v] || r2[v] {
+			union = append(union, v)
+		}
+		if r1[v] && r2[v] {
+			intersection = append(intersection, v)
+		}
+		if r1[v] && !r2[v] {
+			difference = append(difference, v)
+		}
+	}
+	assertIntsEqual(t, "union", union, bitsetMembers(b1.Union(b2)))
+	assertIntsEqual(t, "intersection", intersection, bitsetMembers(b1.Intersection(b2)))
+	assertIntsEqual(t, "difference", difference, bitsetMembers(b1.Difference(b2)))
+	if !sort.IntsAreSorted(bitsetMembers(b1)) || b1.Size() != len(r1) {
+		t.Errorf("Expected %d sorted members, got %d", len(r1), b1.Size())
+	}
+}
+
+func TestBitsetConcurrent(t *testing.T) {
+	fmt.Println("TestBitsetConcurrent")
+	b1, b2 := NewBitset[uint32](), NewBitset[uint32]()
+	stress(t, func(worker, i int) {
+		a, b := b1, b2
+		if worker%2 == 1 {
+			a, b = b2, b1
+		}
+		a.Add(uint32(i))
+		a.UnionWith(b)
+		a.Subset(b)
+		b.Remove(uint32(i))
+		a.NextSet(uint32(i))
+	})
+}
+
+func TestBitsetLargestMembers(t *testing.T) {
+	fmt.Println("TestBitsetLargestMembers")
+	b := NewBitsetOf[uint32](1, 1000)
+	assertOperation(t, "contains the largest uint32", b.Contains(math.MaxUint32), false)
+	assertOperation(t, "remove the largest uint32", b.Remove(math.MaxUint32), false)
+	if prev, ok := b.PrevSet(math.MaxUint32); !ok || prev != 1000 {
+		t.Errorf("Expected PrevSet to find 1000, got %d", prev)
+	}
+	if _, ok := b.NextSet(math.MaxUint32); ok {
+		t.Errorf("Expected NextSet to find nothing past the last member")
+	}
+
+	if err := b.UnmarshalJSON([]byte("[2, 4294967296]")); err == nil {
+		t.Errorf("Expected an error decoding a member that isn't a uint32")
+	}
+	assertIntsEqual(t, "members after a failed decode", []int{1, 1000}, bitsetMembers(b))
+}
@@ -0,0 +1,138 @@
+package set
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// These tests are meant to be run with `go test -race`, they hammer a set from
+// many goroutines and rely on the race detector to flag unsynchronized access.
+
+const (
+	stressWorkers    = 8
+	stressIterations = 500
+)
+
+// TestConcurrentMethods exercises every Set method concurrently
+func TestConcurrentMethods(t *testing.T) {
+	fmt.Println("TestConcurrentMethods")
+	s := getTestSet()
+	stress(t, func(worker, i int) {
+		item := testItem{worker*stressIterations + i}
+		s.Add(item)
+		s.Contains(item)
+		s.Get(item)
+		s.Size()
+		if i%50 == 0 {
+			s.Empty()
+		}
+		s.Remove(item)
+	})
+}
+
+// TestConcurrentIterate verifies iterating while mutating is safe
+func TestConcurrentIterate(t *testing.T) {
+	fmt.Println("TestConcurrentIterate")
+	s := getPopulatedSet(1, 100)
+	stress(t, func(worker, i int) {
+		if worker%2 == 0 {
+			for range s.Iterate(testPredicate, 10) {
+			}
+			return
+		}
+		s.Add(testItem{i})
+		s.Remove(testItem{i})
+	})
+}
+
+// TestConcurrentBinaryOperations runs every binary operation with its operands
+// in both orders while the operands are being written to. If the locks were
+// taken in argument order this would deadlock.
+func TestConcurrentBinaryOperations(t *testing.T) {
+	fmt.Println("TestConcurrentBinaryOperations")
+	testConcurrentBinaryOperations(t, getPopulatedSet(1, 50), getPopulatedSet(25, 75))
+}
+
+// TestConcurrentOrderedSet runs the binary operations between a Set and an OrderedSet
+func TestConcurrentOrderedSet(t *testing.T) {
+	fmt.Println("TestConcurrentOrderedSet")
+	s2 := NewOrderedSet(testComparator)
+	populateSet(s2, 25, 75)
+	testConcurrentBinaryOperations(t, getPopulatedSet(1, 50), s2)
+}
+
+func testConcurrentBinaryOperations(t *testing.T, s1, s2 Set) {
+	comp := func(i1, i2 Item) Comparison { return equal }
+	ops := []func(a, b Set){
+		func(a, b Set) { Union(a, b) },
+		func(a, b Set) { Intersection(a, b) },
+		func(a, b Set) { Difference(a, b) },
+		func(a, b Set) { Filter(testPredicate, a, b) },
+		func(a, b Set) { Equal(a, b) },
+		func(a, b Set) { Subset(a, b) },
+		func(a, b Set) { Superset(a, b) },
+		func(a, b Set) { DeepEqual(a, b, comp) },
+		func(a, b Set) { a.UnionWith(b) },
+		func(a, b Set) { a.IntersectWith(b) },
+		func(a, b Set) { a.DifferenceWith(b) },
+		func(a, b Set) { a.RemoveIf(testPredicate) },
+	}
+	stress(t, func(worker, i int) {
+		a, b := s1, s2
+		if worker%2 == 1 {
+			a, b = s2, s1
+		}
+		ops[i%len(ops)](a, b)
+		if i%3 == 0 {
+			a.Add(testItem{100 + i})
+			b.Remove(testItem{100 + i - 1})
+		}
+	})
+}
+
+// TestSameSetOperations makes sure an operation on a set with itself doesn't
+// try to take the same lock twice
+func TestSameSetOperations(t *testing.T) {
+	fmt.Println("TestSameSetOperations")
+	s := getPopulatedSet(1, 10)
+	stress(t, func(worker, i int) {
+		if worker == 0 {
+			s.Add(testItem{i % 20})
+			s.Remove(testItem{i%20 + 1})
+			return
+		}
+		if !Equal(s, s) {
+			t.Errorf("A set should always equal itself")
+		}
+		Union(s, s)
+		Filter(testPredicate, s, s, s)
+	})
+}
+
+// stress runs fn from stressWorkers goroutines and fails if they don't finish,
+// which is how a deadlock shows up
+func stress(t *testing.T, fn func(worker, i int)) {
+	var wg sync.WaitGroup
+	wg.Add(stressWorkers)
+	for w := 0; w < stressWorkers; w++ {
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				fn(worker, i)
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Timed out waiting for concurrent operations, probable deadlock")
+	}
+}
@@ -0,0 +1,238 @@
+package set
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// binaryVersion is the first byte of the binary encoding of a Set
+const binaryVersion = 1
+
+var (
+	// ErrInvalidEncoding when decoding data that isn't an encoded Set
+	ErrInvalidEncoding = errors.New("invalid encoded set")
+	// ErrUnsupportedVersion when decoding a binary Set written by a newer version of this package
+	ErrUnsupportedVersion = errors.New("unsupported set encoding version")
+)
+
+// ItemCodec turns Items into bytes and back, Set can't do it itself since it
+// only knows Items by their Key. A codec used for JSON must produce valid JSON.
+type ItemCodec interface {
+	EncodeItem(Item) ([]byte, error)
+	DecodeItem([]byte) (Item, error)
+}
+
+// jsonItemCodec is implemented by codecs whose EncodeItem doesn't produce JSON
+// but which know how to, EncodeJSON and DecodeJSON use it when they can
+type jsonItemCodec interface {
+	encodeItemJSON(Item) ([]byte, error)
+	decodeItemJSON([]byte) (Item, error)
+}
+
+// KeyCodec encodes an Item as the raw bytes of its Key, and decodes it with New.
+// It suits Items that can be rebuilt from their Key alone. EncodeJSON writes the
+// Key as a JSON string instead, which like encoding/json replaces bytes that
+// aren't valid UTF-8 with U+FFFD, so only the binary format keeps every Key.
+type KeyCodec struct {
+	New func(key string) (Item, error)
+}
+
+// EncodeItem returns the Item's Key
+func (c KeyCodec) EncodeItem(item Item) ([]byte, error) {
+	return []byte(item.Key()), nil
+}
+
+// DecodeItem passes the Key to New
+func (c KeyCodec) DecodeItem(data []byte) (Item, error) {
+	return c.New(string(data))
+}
+
+func (c KeyCodec) encodeItemJSON(item Item) ([]byte, error) {
+	return json.Marshal(item.Key())
+}
+
+func (c KeyCodec) decodeItemJSON(data []byte) (Item, error) {
+	var key string
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	return c.New(key)
+}
+
+// JSONCodec encodes Items of type T with encoding/json
+type JSONCodec[T Item] struct{}
+
+// EncodeItem marshals the Item to JSON
+func (JSONCodec[T]) EncodeItem(item Item) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+// DecodeItem unmarshals JSON into a T
+func (JSONCodec[T]) DecodeItem(data []byte) (Item, error) {
+	var item T
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// GobCodec encodes Items of type T with encoding/gob, it can't be used for JSON
+type GobCodec[T Item] struct{}
+
+// EncodeItem gob encodes the Item, which must be a T
+func (GobCodec[T]) EncodeItem(item Item) ([]byte, error) {
+	t, ok := item.(T)
+	if !ok {
+		return nil, fmt.Errorf("set: GobCodec cannot encode %T", item)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(t); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeItem gob decodes a T
+func (GobCodec[T]) DecodeItem(data []byte) (Item, error) {
+	var item T
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// EncodeJSON writes the Items of s as a JSON array
+func EncodeJSON(s Set, codec ItemCodec) ([]byte, error) {
+	encode := codec.EncodeItem
+	if c, ok := codec.(jsonItemCodec); ok {
+		encode = c.encodeItemJSON
+	}
+	items := s.Snapshot()
+	encoded := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		data, err := encode(item)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = data
+	}
+	return json.Marshal(encoded)
+}
+
+// DecodeJSON adds the Items of a JSON array to s
+func DecodeJSON(data []byte, s Set, codec ItemCodec) error {
+	var encoded []json.RawMessage
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decode := codec.DecodeItem
+	if c, ok := codec.(jsonItemCodec); ok {
+		decode = c.decodeItemJSON
+	}
+	items := make([]Item, len(encoded))
+	for i, raw := range encoded {
+		item, err := decode(raw)
+		if err != nil {
+			return err
+		}
+		items[i] = item
+	}
+	for _, item := range items {
+		s.Add(item)
+	}
+	return nil
+}
+
+// EncodeBinary writes the Items of s in a compact format: a version byte, the
+// number of Items as a uvarint, then each encoded Item prefixed by its length
+// as a uvarint
+func EncodeBinary(s Set, codec ItemCodec) ([]byte, error) {
+	items := s.Snapshot()
+	buf := binary.AppendUvarint([]byte{binaryVersion}, uint64(len(items)))
+	for _, item := range items {
+		data, err := codec.EncodeItem(item)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+// DecodeBinary adds the Items written by EncodeBinary to s
+func DecodeBinary(data []byte, s Set, codec ItemCodec) error {
+	if len(data) == 0 {
+		return ErrInvalidEncoding
+	}
+	if data[0] != binaryVersion {
+		return ErrUnsupportedVersion
+	}
+	data = data[1:]
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return ErrInvalidEncoding
+	}
+	data = data[n:]
+
+	items := make([]Item, 0, count)
+	for i := uint64(0); i < count; i++ {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return ErrInvalidEncoding
+		}
+		item, err := codec.DecodeItem(data[n : n+int(length)])
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+		data = data[n+int(length):]
+	}
+	if len(data) != 0 {
+		return ErrInvalidEncoding
+	}
+
+	for _, item := range items {
+		s.Add(item)
+	}
+	return nil
+}
+
+// Encodable pairs a Set with an ItemCodec so it can be used with encoding/json,
+// encoding/gob or anything else that accepts the standard marshaler interfaces.
+// When decoding into an Encodable without a Set, a new one is made with NewSet.
+type Encodable struct {
+	Set   Set
+	Codec ItemCodec
+}
+
+// MarshalJSON implements json.Marshaler
+func (e Encodable) MarshalJSON() ([]byte, error) {
+	return EncodeJSON(e.Set, e.Codec)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *Encodable) UnmarshalJSON(data []byte) error {
+	if e.Set == nil {
+		e.Set = NewSet()
+	}
+	return DecodeJSON(data, e.Set, e.Codec)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, which encoding/gob also uses
+func (e Encodable) MarshalBinary() ([]byte, error) {
+	return EncodeBinary(e.Set, e.Codec)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, which encoding/gob also uses
+func (e *Encodable) UnmarshalBinary(data []byte) error {
+	if e.Set == nil {
+		e.Set = NewSet()
+	}
+	return DecodeBinary(data, e.Set, e.Codec)
+}
@@ -0,0 +1,281 @@
+package set
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+type recordItem struct {
+	ID   int
+	Name string
+}
+
+func (r recordItem) Key() string {
+	return strconv.Itoa(r.ID)
+}
+
+var testKeyCodec = KeyCodec{New: func(key string) (Item, error) {
+	i, err := strconv.Atoi(key)
+	return testItem{i}, err
+}}
+
+// keyItem is an Item that's nothing but its Key
+type keyItem string
+
+func (k keyItem) Key() string {
+	return string(k)
+}
+
+var keyItemCodec = KeyCodec{New: func(key string) (Item, error) {
+	return keyItem(key), nil
+}}
+
+func getRecordSet() Set {
+	s := NewSet()
+	for i := 1; i <= 5; i++ {
+		s.Add(recordItem{i, fmt.Sprint("record ", i)})
+	}
+	return s
+}
+
+// TestSetRoundTrip encodes and decodes each Item based set variant with every codec and format
+func TestSetRoundTrip(t *testing.T) {
+	fmt.Println("TestSetRoundTrip")
+	ordered := NewOrderedSet(testComparator)
+	populateSet(ordered, 1, 10)
+	striped := NewStripedSet(4)
+	populateSet(striped, 1, 10)
+	observable := NewObservableSet(getPopulatedSet(1, 10))
+	escaped := NewSet()
+	for _, key := range []string{"a\x01b", "tab\tnewline\n", `quote" backslash\`, "\u2028"} {
+		escaped.Add(keyItem(key))
+	}
+	var tests = []struct {
+		name  string
+		s     Set
+		empty func() Set
+		codec ItemCodec
+	}{
+		{"set with key codec", getPopulatedSet(1, 10), NewSet, testKeyCodec},
+		{"empty set", getPopulatedSet(1, 0), NewSet, testKeyCodec},
+		{"set with json codec", getRecordSet(), NewSet, JSONCodec[recordItem]{}},
+		{"set with gob codec", getRecordSet(), NewSet, GobCodec[recordItem]{}},
+		{"ordered set", ordered, func() Set { return NewOrderedSet(testComparator) }, testKeyCodec},
+		{"striped set", striped, func() Set { return NewStripedSet(4) }, testKeyCodec},
+		{"observable set", observable, func() Set { return NewObservableSet(NewSet()) }, testKeyCodec},
+		{"keys needing escapes", escaped, NewSet, keyItemCodec},
+	}
+	formats := []struct {
+		name   string
+		encode func(Set, ItemCodec) ([]byte, error)
+		decode func([]byte, Set, ItemCodec) error
+	}{
+		{"json", EncodeJSON, DecodeJSON},
+		{"binary", EncodeBinary, DecodeBinary},
+	}
+	for _, test := range tests {
+		for _, format := range formats {
+			if _, isGob := test.codec.(GobCodec[recordItem]); isGob && format.name == "json" {
+				continue
+			}
+			data, err := format.encode(test.s, test.codec)
+			if err != nil {
+				t.Errorf("%s %s: error encoding: %s", test.name, format.name, err)
+				continue
+			}
+			decoded := test.empty()
+			if err := format.decode(data, decoded, test.codec); err != nil {
+				t.Errorf("%s %s: error decoding: %s", test.name, format.name, err)
+				continue
+			}
+			same := DeepEqual(test.s, decoded, func(i1, i2 Item) Comparison {
+				if i1 != i2 {
+					return lessThan
+				}
+				return equal
+			})
+			if !same {
+				t.Errorf("%s %s: decoded set isn't equal to the original", test.name, format.name)
+			}
+		}
+	}
+}
+
+func TestEncodeJSONArray(t *testing.T) {
+	fmt.Println("TestEncodeJSONArray")
+	ordered := NewOrderedSet(testComparator)
+	populateSet(ordered, 1, 3)
+	data, err := EncodeJSON(ordered, testKeyCodec)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != `["1","2","3"]` {
+		t.Errorf("Expected a JSON array of keys, got %s", data)
+	}
+
+	if _, err := EncodeJSON(getRecordSet(), GobCodec[recordItem]{}); err == nil {
+		t.Errorf("Expected an error encoding JSON with a codec that doesn't produce JSON")
+	}
+}
+
+func TestKeyCodecInvalidUTF8(t *testing.T) {
+	fmt.Println("TestKeyCodecInvalidUTF8")
+	s := NewSet()
+	s.Add(keyItem("\xff"))
+	s.Add(keyItem("\xfe"))
+
+	data, err := EncodeBinary(s, keyItemCodec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	decoded := NewSet()
+	if err := DecodeBinary(data, decoded, keyItemCodec); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if decoded.Size() != 2 || !decoded.Contains(keyItem("\xff")) || !decoded.Contains(keyItem("\xfe")) {
+		t.Errorf("Expected both keys to round trip exactly, got %q", decoded.Snapshot())
+	}
+
+	// JSON can't hold them, they must still encode as valid JSON
+	data, err = EncodeJSON(s, keyItemCodec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !json.Valid(data) {
+		t.Errorf("Expected valid JSON, got %s", data)
+	}
+}
+
+func TestKeyCodecBinaryIsRaw(t *testing.T) {
+	fmt.Println("TestKeyCodecBinaryIsRaw")
+	s := NewSet()
+	s.Add(keyItem(`a"b`))
+	data, _ := EncodeBinary(s, keyItemCodec)
+	if expected := []byte{binaryVersion, 1, 3, 'a', '"', 'b'}; !bytes.Equal(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+}
+
+func TestGobCodecMixedItems(t *testing.T) {
+	fmt.Println("TestGobCodecMixedItems")
+	s := getRecordSet()
+	s.Add(testItem{100})
+	if _, err := EncodeBinary(s, GobCodec[recordItem]{}); err == nil {
+		t.Errorf("Expected an error encoding an Item that isn't a recordItem")
+	}
+}
+
+func TestEncodable(t *testing.T) {
+	fmt.Println("TestEncodable")
+	type document struct {
+		Title string
+		Tags  Encodable
+	}
+	doc := document{"doc", Encodable{getPopulatedSet(1, 5), testKeyCodec}}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Error(err)
+	}
+	decoded := document{Tags: Encodable{Codec: testKeyCodec}}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Error(err)
+	}
+	assertOperation(t, "json round trip", Equal(decoded.Tags.Set, doc.Tags.Set), true)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(doc); err != nil {
+		t.Error(err)
+	}
+	decoded = document{Tags: Encodable{Codec: testKeyCodec}}
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Error(err)
+	}
+	assertOperation(t, "gob round trip", Equal(decoded.Tags.Set, doc.Tags.Set), true)
+}
+
+func TestDecodeBinaryInvalid(t *testing.T) {
+	fmt.Println("TestDecodeBinaryInvalid")
+	valid, _ := EncodeBinary(getPopulatedSet(1, 3), testKeyCodec)
+	var tests = []struct {
+		data []byte
+		err  error
+	}{
+		{nil, ErrInvalidEncoding},
+		{[]byte{2, 0}, ErrUnsupportedVersion},
+		{valid[:len(valid)-1], ErrInvalidEncoding},
+		{append(valid, 0), ErrInvalidEncoding},
+		{[]byte{binaryVersion, 100}, ErrInvalidEncoding},
+	}
+	for i, test := range tests {
+		if err := DecodeBinary(test.data, NewSet(), testKeyCodec); err != test.err {
+			t.Errorf("Case %d failed, expected error %s, got [%v] instead", i+1, test.err, err)
+		}
+	}
+}
+
+// TestIntegerSetRoundTrip encodes and decodes Bitset and Roaring in every format
+func TestIntegerSetRoundTrip(t *testing.T) {
+	fmt.Println("TestIntegerSetRoundTrip")
+	bitset := NewBitsetOf[uint32](1, 64, 100, 5000)
+	roaring := NewRoaringOf(1, 64, 100, 5000, 1<<20)
+	roaring.RunOptimize()
+
+	var tests = []struct {
+		name     string
+		original any
+		decoded  any
+	}{
+		{"bitset", bitset, NewBitset[uint32]()},
+		{"roaring", roaring, NewRoaring()},
+	}
+	for _, test := range tests {
+		formats := []struct {
+			name   string
+			encode func(any) ([]byte, error)
+			decode func([]byte, any) error
+		}{
+			{"json", json.Marshal, json.Unmarshal},
+			{"gob", gobEncode, gobDecode},
+		}
+		for _, format := range formats {
+			data, err := format.encode(test.original)
+			if err != nil {
+				t.Errorf("%s %s: error encoding: %s", test.name, format.name, err)
+				continue
+			}
+			if err := format.decode(data, test.decoded); err != nil {
+				t.Errorf("%s %s: error decoding: %s", test.name, format.name, err)
+				continue
+			}
+			var same bool
+			switch original := test.original.(type) {
+			case *Bitset[uint32]:
+				same = original.Equal(test.decoded.(*Bitset[uint32]))
+			case *Roaring:
+				same = original.Equal(test.decoded.(*Roaring))
+			}
+			if !same {
+				t.Errorf("%s %s: decoded set isn't equal to the original", test.name, format.name)
+			}
+		}
+	}
+
+	if err := NewBitset[uint32]().UnmarshalBinary([]byte{binaryVersion, 2, 1}); err != ErrInvalidEncoding {
+		t.Errorf("Expected error %s, got [%v] instead", ErrInvalidEncoding, err)
+	}
+}
+
+func gobEncode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func gobDecode(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,343 @@
+package set
+
+import (
+	"iter"
+	"sort"
+)
+
+// Expr is a lazily evaluated set expression. Combining Exprs only builds a tree,
+// nothing is computed until Eval, Count, Contains or All is called, and then the
+// whole tree is evaluated in one pass without building intermediate sets:
+//
+//	Lazy(a).Intersect(Lazy(b).Union(Lazy(c))).Filter(p).Count()
+//
+// Evaluation read locks every Set in the tree for its duration, so it sees a
+// consistent view of all of them. Intersections enumerate their smallest
+// operand and check the others from smallest to largest, stopping at the first
+// miss. An Item in the result is the value from the operand it was enumerated
+// from, unions prefer their earliest operand.
+type Expr struct {
+	root exprNode
+}
+
+// exprNode is a node of an expression tree. Leaf maps are looked up in env,
+// which holds the data() of every leaf for the duration of an evaluation.
+type exprNode interface {
+	leaves(sets []Set) []Set
+	// estimate is an upper bound on the size of the result, used for planning
+	estimate(env env) int
+	// plan returns the node rewritten into the cheapest order to evaluate it in
+	plan(env env) exprNode
+	// lookup returns the value in the result with key
+	lookup(env env, key string) (Item, bool)
+	each(env env, yield func(Item) bool) bool
+}
+
+type env map[Set]map[string]Item
+
+// Lazy returns an expression whose value is s
+func Lazy(s Set) Expr {
+	return Expr{root: leafExpr{s}}
+}
+
+// Union returns an expression for the union of e and others
+func (e Expr) Union(others ...Expr) Expr {
+	return Expr{root: unionExpr(append([]exprNode{e.root}, roots(others)...))}
+}
+
+// Intersect returns an expression for the intersection of e and others
+func (e Expr) Intersect(others ...Expr) Expr {
+	return Expr{root: intersectExpr(append([]exprNode{e.root}, roots(others)...))}
+}
+
+// Difference returns an expression for the Items of e that aren't in other
+func (e Expr) Difference(other Expr) Expr {
+	return Expr{root: differenceExpr{e.root, other.root}}
+}
+
+// Filter returns an expression for the Items of e matching p
+func (e Expr) Filter(p Predicate) Expr {
+	return Expr{root: filterExpr{e.root, p}}
+}
+
+func roots(exprs []Expr) []exprNode {
+	nodes := make([]exprNode, len(exprs))
+	for i, e := range exprs {
+		nodes[i] = e.root
+	}
+	return nodes
+}
+
+// All evaluates the expression, yielding each Item of the result. The Sets in
+// the expression stay read locked until the loop ends, so its body mustn't modify them.
+func (e Expr) All() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		env, unlock := e.lock()
+		defer unlock()
+
+		e.root.plan(env).each(env, yield)
+	}
+}
+
+// Eval materializes the result into a new Set
+func (e Expr) Eval() (Set, error) {
+	result := NewSet()
+	m := result.data()
+	for item := range e.All() {
+		m[item.Key()] = item
+	}
+	return result, nil
+}
+
+// Count returns the size of the result without materializing it
+func (e Expr) Count() int {
+	count := 0
+	for range e.All() {
+		count++
+	}
+	return count
+}
+
+// Contains evaluates the expression for the Key of item alone
+func (e Expr) Contains(item Item) bool {
+	env, unlock := e.lock()
+	defer unlock()
+
+	_, exists := e.root.plan(env).lookup(env, item.Key())
+	return exists
+}
+
+// lock read locks every Set in the expression and captures their data
+func (e Expr) lock() (env, func()) {
+	sets := e.root.leaves(nil)
+	unlock := rlockAll(sets...)
+	env := make(env, len(sets))
+	for _, s := range sets {
+		env[s] = s.data()
+	}
+	return env, unlock
+}
+
+type leafExpr struct {
+	s Set
+}
+
+func (l leafExpr) leaves(sets []Set) []Set {
+	return append(sets, l.s)
+}
+
+func (l leafExpr) estimate(env env) int {
+	return len(env[l.s])
+}
+
+func (l leafExpr) plan(env env) exprNode {
+	return l
+}
+
+func (l leafExpr) lookup(env env, key string) (Item, bool) {
+	item, exists := env[l.s][key]
+	return item, exists
+}
+
+func (l leafExpr) each(env env, yield func(Item) bool) bool {
+	for _, item := range env[l.s] {
+		if !yield(item) {
+			return false
+		}
+	}
+	return true
+}
+
+type unionExpr []exprNode
+
+func (u unionExpr) leaves(sets []Set) []Set {
+	for _, n := range u {
+		sets = n.leaves(sets)
+	}
+	return sets
+}
+
+func (u unionExpr) estimate(env env) int {
+	total := 0
+	for _, n := range u {
+		total += n.estimate(env)
+	}
+	return total
+}
+
+func (u unionExpr) plan(env env) exprNode {
+	planned := make(unionExpr, len(u))
+	for i, n := range u {
+		planned[i] = n.plan(env)
+	}
+	return planned
+}
+
+func (u unionExpr) lookup(env env, key string) (Item, bool) {
+	for _, n := range u {
+		if item, exists := n.lookup(env, key); exists {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// each enumerates the operands in turn, skipping Items an earlier operand already yielded
+func (u unionExpr) each(env env, yield func(Item) bool) bool {
+	for i, n := range u {
+		earlier := u[:i]
+		more := n.each(env, func(item Item) bool {
+			if _, exists := earlier.lookup(env, item.Key()); exists {
+				return true
+			}
+			return yield(item)
+		})
+		if !more {
+			return false
+		}
+	}
+	return true
+}
+
+type intersectExpr []exprNode
+
+func (x intersectExpr) leaves(sets []Set) []Set {
+	for _, n := range x {
+		sets = n.leaves(sets)
+	}
+	return sets
+}
+
+func (x intersectExpr) estimate(env env) int {
+	smallest := x[0].estimate(env)
+	for _, n := range x[1:] {
+		smallest = min(smallest, n.estimate(env))
+	}
+	return smallest
+}
+
+// plan orders the operands from the smallest estimate to the largest, so the
+// smallest is enumerated and misses are found as early as possible
+func (x intersectExpr) plan(env env) exprNode {
+	planned := make(intersectExpr, len(x))
+	estimates := make([]int, len(x))
+	for i, n := range x {
+		planned[i] = n.plan(env)
+		estimates[i] = planned[i].estimate(env)
+	}
+	sort.Stable(byEstimate{planned, estimates})
+	return planned
+}
+
+type byEstimate struct {
+	nodes     intersectExpr
+	estimates []int
+}
+
+func (b byEstimate) Len() int           { return len(b.nodes) }
+func (b byEstimate) Less(i, j int) bool { return b.estimates[i] < b.estimates[j] }
+func (b byEstimate) Swap(i, j int) {
+	b.nodes[i], b.nodes[j] = b.nodes[j], b.nodes[i]
+	b.estimates[i], b.estimates[j] = b.estimates[j], b.estimates[i]
+}
+
+// lookup returns the value from the first operand, which after planning is the smallest
+func (x intersectExpr) lookup(env env, key string) (Item, bool) {
+	item, exists := x[0].lookup(env, key)
+	if !exists {
+		return nil, false
+	}
+	for _, n := range x[1:] {
+		if _, exists := n.lookup(env, key); !exists {
+			return nil, false
+		}
+	}
+	return item, true
+}
+
+// each enumerates the first operand, which after planning is the smallest
+func (x intersectExpr) each(env env, yield func(Item) bool) bool {
+	if x[0].estimate(env) == 0 {
+		return true
+	}
+	rest := x[1:]
+	return x[0].each(env, func(item Item) bool {
+		key := item.Key()
+		for _, n := range rest {
+			if _, exists := n.lookup(env, key); !exists {
+				return true
+			}
+		}
+		return yield(item)
+	})
+}
+
+type differenceExpr struct {
+	from, exclude exprNode
+}
+
+func (d differenceExpr) leaves(sets []Set) []Set {
+	return d.exclude.leaves(d.from.leaves(sets))
+}
+
+func (d differenceExpr) estimate(env env) int {
+	return d.from.estimate(env)
+}
+
+func (d differenceExpr) plan(env env) exprNode {
+	return differenceExpr{d.from.plan(env), d.exclude.plan(env)}
+}
+
+func (d differenceExpr) lookup(env env, key string) (Item, bool) {
+	item, exists := d.from.lookup(env, key)
+	if !exists {
+		return nil, false
+	}
+	if _, excluded := d.exclude.lookup(env, key); excluded {
+		return nil, false
+	}
+	return item, true
+}
+
+func (d differenceExpr) each(env env, yield func(Item) bool) bool {
+	return d.from.each(env, func(item Item) bool {
+		if _, excluded := d.exclude.lookup(env, item.Key()); excluded {
+			return true
+		}
+		return yield(item)
+	})
+}
+
+type filterExpr struct {
+	n exprNode
+	p Predicate
+}
+
+func (f filterExpr) leaves(sets []Set) []Set {
+	return f.n.leaves(sets)
+}
+
+func (f filterExpr) estimate(env env) int {
+	return f.n.estimate(env)
+}
+
+func (f filterExpr) plan(env env) exprNode {
+	return filterExpr{f.n.plan(env), f.p}
+}
+
+func (f filterExpr) lookup(env env, key string) (Item, bool) {
+	item, exists := f.n.lookup(env, key)
+	if !exists || !f.p(item) {
+		return nil, false
+	}
+	return item, true
+}
+
+func (f filterExpr) each(env env, yield func(Item) bool) bool {
+	return f.n.each(env, func(item Item) bool {
+		if !f.p(item) {
+			return true
+		}
+		return yield(item)
+	})
+}
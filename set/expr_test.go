@@ -0,0 +1,100 @@
+package set
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	fmt.Println("TestExprEval")
+	a, b, c := getPopulatedSet(1, 20), getPopulatedSet(5, 10), getPopulatedSet(15, 30)
+	var tests = []struct {
+		expr     Expr
+		expected []int
+	}{
+		{Lazy(a).Intersect(Lazy(b).Union(Lazy(c))), []int{5, 6, 7, 8, 9, 10, 15, 16, 17, 18, 19, 20}},
+		{Lazy(a).Intersect(Lazy(b).Union(Lazy(c))).Filter(testPredicate), []int{5, 7, 9, 15, 17, 19}},
+		{Lazy(b).Union(Lazy(c), Lazy(b)), []int{5, 6, 7, 8, 9, 10, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}},
+		{Lazy(a).Difference(Lazy(b).Union(Lazy(c))), []int{1, 2, 3, 4, 11, 12, 13, 14}},
+		{Lazy(b).Intersect(Lazy(c)), []int{}},
+		{Lazy(a).Intersect(Lazy(a)), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{Lazy(c).Filter(testPredicate).Difference(Lazy(a)), []int{21, 23, 25, 27, 29}},
+	}
+	for i, test := range tests {
+		result, err := test.expr.Eval()
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		assertSetSize(t, result, len(test.expected))
+		assertSetContainsItems(t, result, test.expected)
+		if count := test.expr.Count(); count != len(test.expected) {
+			t.Errorf("Case %d failed, expected count %d, got %d", i+1, len(test.expected), count)
+		}
+		for v := 0; v <= 31; v++ {
+			if test.expr.Contains(testItem{v}) != result.Contains(testItem{v}) {
+				t.Errorf("Case %d failed, Contains(%d) disagrees with the evaluated set", i+1, v)
+			}
+		}
+	}
+}
+
+// TestExprMatchesEager compares a lazy expression to the eager package operations
+func TestExprMatchesEager(t *testing.T) {
+	fmt.Println("TestExprMatchesEager")
+	a, b, c := getPopulatedSet(1, 100), getPopulatedSet(50, 150), getPopulatedSet(25, 75)
+	u, _ := Union(b, c)
+	x, _ := Intersection(a, u)
+	d, _ := Difference(x, getPopulatedSet(60, 70))
+	eager, _ := Filter(testPredicate, d)
+
+	lazy, _ := Lazy(a).Intersect(Lazy(b).Union(Lazy(c))).Difference(Lazy(getPopulatedSet(60, 70))).Filter(testPredicate).Eval()
+	assertOperation(t, "lazy matches eager", Equal(eager, lazy), true)
+}
+
+func TestExprPlanning(t *testing.T) {
+	fmt.Println("TestExprPlanning")
+	calls := 0
+	counting := func(item Item) bool {
+		calls++
+		return true
+	}
+	big, small := getPopulatedSet(1, 1000), getPopulatedSet(1, 10)
+
+	// the small operand is enumerated, so the filter over the big one is only
+	// consulted for its 10 items
+	if count := Lazy(big).Filter(counting).Intersect(Lazy(small)).Count(); count != 10 {
+		t.Errorf("Expected count 10, got %d", count)
+	}
+	if calls > 10 {
+		t.Errorf("Expected the predicate to run at most 10 times, it ran %d", calls)
+	}
+
+	calls = 0
+	if count := Lazy(big).Filter(counting).Intersect(Lazy(NewSet())).Count(); count != 0 {
+		t.Errorf("Expected count 0, got %d", count)
+	}
+	if calls != 0 {
+		t.Errorf("Expected an empty operand to short circuit, the predicate ran %d times", calls)
+	}
+
+	calls = 0
+	for range Lazy(big).Filter(counting).All() {
+		break
+	}
+	if calls != 1 {
+		t.Errorf("Expected breaking out of All to stop evaluation, the predicate ran %d times", calls)
+	}
+}
+
+func TestExprUnionPrecedence(t *testing.T) {
+	fmt.Println("TestExprUnionPrecedence")
+	s1, s2 := getTestSet(), getTestSet()
+	populateSetItem2(s1, 1, 5, func(i int) int { return 1 })
+	populateSetItem2(s2, 1, 10, func(i int) int { return 2 })
+	for item := range Lazy(s1).Union(Lazy(s2)).All() {
+		i := item.(testItem2)
+		if (i.i <= 5) != (i.extra == 1) {
+			t.Errorf("Expected item %d to come from the first operand that has it", i.i)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package set
+
+// UnionWith adds every item of other that isn't already in the set and returns how many were added
+func (s *set) UnionWith(other Set) int {
+	defer lockWith(s, other)()
+
+	added := 0
+	for key, item := range other.data() {
+		if _, exists := s.m[key]; exists {
+			continue
+		}
+		s.m[key] = item
+		added++
+	}
+	return added
+}
+
+// IntersectWith removes every item that isn't in other and returns how many were removed
+func (s *set) IntersectWith(other Set) int {
+	defer lockWith(s, other)()
+
+	keep := other.data()
+	removed := 0
+	for key := range s.m {
+		if _, exists := keep[key]; !exists {
+			delete(s.m, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// DifferenceWith removes every item that is in other and returns how many were removed
+func (s *set) DifferenceWith(other Set) int {
+	defer lockWith(s, other)()
+
+	removed := 0
+	for key := range other.data() {
+		if _, exists := s.m[key]; exists {
+			delete(s.m, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// RetainIf removes every item not matching the predicate and returns how many were removed
+func (s *set) RetainIf(pred Predicate) int {
+	return s.RemoveIf(func(item Item) bool {
+		return !pred(item)
+	})
+}
+
+// RemoveIf removes every item matching the predicate and returns how many were removed
+func (s *set) RemoveIf(pred Predicate) int {
+	s.lock(true)
+	defer s.unlock(true)
+
+	removed := 0
+	for key, item := range s.m {
+		if pred(item) {
+			delete(s.m, key)
+			removed++
+		}
+	}
+	return removed
+}
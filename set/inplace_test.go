@@ -0,0 +1,97 @@
+package set
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnionWith(t *testing.T) {
+	fmt.Println("TestUnionWith")
+	var tests = []struct {
+		setArgs, expected []int
+		changed           int
+	}{
+		{setArgs: []int{1, 5, 6, 10}, expected: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, changed: 5},
+		{setArgs: []int{1, 5, 3, 7}, expected: []int{1, 2, 3, 4, 5, 6, 7}, changed: 2},
+		{setArgs: []int{1, 5, 1, 5}, expected: []int{1, 2, 3, 4, 5}, changed: 0},
+		{setArgs: []int{1, 0, 1, 2}, expected: []int{1, 2}, changed: 2},
+	}
+	for i, test := range tests {
+		s1 := getPopulatedSet(test.setArgs[0], test.setArgs[1])
+		s2 := getPopulatedSet(test.setArgs[2], test.setArgs[3])
+		if changed := s1.UnionWith(s2); changed != test.changed {
+			t.Errorf("Case %d failed, expected %d changes, got %d", i+1, test.changed, changed)
+		}
+		assertSetSize(t, s1, len(test.expected))
+		assertSetContainsItems(t, s1, test.expected)
+	}
+}
+
+func TestIntersectWith(t *testing.T) {
+	fmt.Println("TestIntersectWith")
+	var tests = []struct {
+		setArgs, expected []int
+		changed           int
+	}{
+		{setArgs: []int{1, 5, 6, 10}, expected: []int{}, changed: 5},
+		{setArgs: []int{1, 5, 3, 7}, expected: []int{3, 4, 5}, changed: 2},
+		{setArgs: []int{1, 5, 1, 5}, expected: []int{1, 2, 3, 4, 5}, changed: 0},
+	}
+	for i, test := range tests {
+		s1 := getPopulatedSet(test.setArgs[0], test.setArgs[1])
+		s2 := getPopulatedSet(test.setArgs[2], test.setArgs[3])
+		if changed := s1.IntersectWith(s2); changed != test.changed {
+			t.Errorf("Case %d failed, expected %d changes, got %d", i+1, test.changed, changed)
+		}
+		assertSetSize(t, s1, len(test.expected))
+		assertSetContainsItems(t, s1, test.expected)
+	}
+}
+
+func TestDifferenceWith(t *testing.T) {
+	fmt.Println("TestDifferenceWith")
+	var tests = []struct {
+		setArgs, expected []int
+		changed           int
+	}{
+		{setArgs: []int{1, 5, 6, 10}, expected: []int{1, 2, 3, 4, 5}, changed: 0},
+		{setArgs: []int{1, 5, 3, 7}, expected: []int{1, 2}, changed: 3},
+		{setArgs: []int{1, 5, 1, 5}, expected: []int{}, changed: 5},
+	}
+	for i, test := range tests {
+		s1 := getPopulatedSet(test.setArgs[0], test.setArgs[1])
+		s2 := getPopulatedSet(test.setArgs[2], test.setArgs[3])
+		if changed := s1.DifferenceWith(s2); changed != test.changed {
+			t.Errorf("Case %d failed, expected %d changes, got %d", i+1, test.changed, changed)
+		}
+		assertSetSize(t, s1, len(test.expected))
+		assertSetContainsItems(t, s1, test.expected)
+	}
+}
+
+func TestInPlaceWithSelf(t *testing.T) {
+	fmt.Println("TestInPlaceWithSelf")
+	s := getPopulatedSet(1, 5)
+	assertOperation(t, "union with self changes nothing", s.UnionWith(s) == 0, true)
+	assertOperation(t, "intersect with self changes nothing", s.IntersectWith(s) == 0, true)
+	assertSetSize(t, s, 5)
+	assertOperation(t, "difference with self removes everything", s.DifferenceWith(s) == 5, true)
+	assertSetSize(t, s, 0)
+}
+
+func TestRetainIf(t *testing.T) {
+	fmt.Println("TestRetainIf")
+	s := getPopulatedSet(1, 10)
+	assertOperation(t, "retain odd items removes 5", s.RetainIf(testPredicate) == 5, true)
+	assertSetSize(t, s, 5)
+	assertSetContainsItems(t, s, []int{1, 3, 5, 7, 9})
+}
+
+func TestRemoveIf(t *testing.T) {
+	fmt.Println("TestRemoveIf")
+	s := getPopulatedSet(1, 10)
+	assertOperation(t, "remove odd items removes 5", s.RemoveIf(testPredicate) == 5, true)
+	assertSetSize(t, s, 5)
+	assertSetContainsItems(t, s, []int{2, 4, 6, 8, 10})
+	assertOperation(t, "remove odd items again removes nothing", s.RemoveIf(testPredicate) == 0, true)
+}
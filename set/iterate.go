@@ -1,6 +1,9 @@
 package set
 
-import "sync"
+import (
+	"context"
+	"iter"
+)
 
 var (
 	// PredicateAll is a Predicate that matches everything in the set
@@ -9,31 +12,86 @@ var (
 	}
 )
 
-func (s *set) IterateAll() <-chan Item {
-	return s.iterate(PredicateAll, s.Size())
+// Snapshot returns a copy of the set's Items taken under the read lock
+func (s *set) Snapshot() []Item {
+	return s.snapshot(PredicateAll, -1)
 }
 
-func (s *set) Iterate(pred Predicate, limit int) <-chan Item {
-	return s.iterate(pred, limit)
+// snapshot collects up to limit Items matching pred, a negative limit means no limit
+func (s *set) snapshot(pred Predicate, limit int) []Item {
+	s.lock(false)
+	defer s.unlock(false)
+
+	size := len(s.m)
+	if limit >= 0 && limit < size {
+		size = limit
+	}
+	items := make([]Item, 0, size)
+	for _, item := range s.m {
+		if len(items) == limit {
+			break
+		}
+		if pred(item) {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
-func (s *set) iterate(pred Predicate, limit int) <-chan Item {
-	iter := make(chan Item)
+// All iterates a snapshot of the set, no lock is held while the loop body runs
+// so it's free to break early or modify the set
+func (s *set) All() iter.Seq[Item] {
+	return s.Select(PredicateAll, -1)
+}
 
-	s.lock.RLock()
-	go func(lock *sync.RWMutex) {
-		defer lock.RUnlock()
-		defer close(iter)
-		i := 0
-		for _, item := range s.data() {
-			if pred(item) {
-				iter <- item
-				i++
-			}
-			if i == limit {
-				break
+// Select iterates a snapshot of up to limit Items matching pred, a negative limit means no limit
+func (s *set) Select(pred Predicate, limit int) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		yieldAll(s.snapshot(pred, limit), yield)
+	}
+}
+
+func yieldAll(items []Item, yield func(Item) bool) {
+	for _, item := range items {
+		if !yield(item) {
+			return
+		}
+	}
+}
+
+// IterateCtx sends up to limit Items matching pred on the returned channel, which
+// is closed once they've all been sent or ctx is done. Items come from a snapshot,
+// so the set is never locked while the receiver is running.
+func (s *set) IterateCtx(ctx context.Context, pred Predicate, limit int) <-chan Item {
+	return sendAll(ctx, s.snapshot(pred, limit))
+}
+
+// sendAll sends items on the returned channel from a new goroutine, closing it when done or when ctx is
+func sendAll(ctx context.Context, items []Item) <-chan Item {
+	ch := make(chan Item)
+	go func() {
+		defer close(ch)
+		for _, item := range items {
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return
 			}
 		}
-	}(s.lock)
-	return iter
+	}()
+	return ch
+}
+
+// IterateAll sends every Item on the returned channel
+//
+// Deprecated: the sending goroutine leaks unless the channel is drained, use All or IterateCtx
+func (s *set) IterateAll() <-chan Item {
+	return s.IterateCtx(context.Background(), PredicateAll, -1)
+}
+
+// Iterate sends up to limit Items matching pred on the returned channel
+//
+// Deprecated: the sending goroutine leaks unless the channel is drained, use Select or IterateCtx
+func (s *set) Iterate(pred Predicate, limit int) <-chan Item {
+	return s.IterateCtx(context.Background(), pred, limit)
 }
@@ -1,6 +1,7 @@
 package set
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"testing"
@@ -63,6 +64,93 @@ func TestIteratePredicateLimit(t *testing.T) {
 	}
 }
 
+// TestAll verifies All yields every item
+func TestAll(t *testing.T) {
+	fmt.Println("TestAll")
+	s := getPopulatedSet(1, 5)
+	var actual []string
+	for item := range s.All() {
+		actual = append(actual, item.Key())
+	}
+	assertKeyArrayEquals(t, []string{"1", "2", "3", "4", "5"}, actual)
+}
+
+// TestAllBreak verifies breaking out of All doesn't leave the set locked
+func TestAllBreak(t *testing.T) {
+	fmt.Println("TestAllBreak")
+	s := getPopulatedSet(1, 10)
+	for range s.All() {
+		break
+	}
+	for item := range s.All() {
+		s.Remove(item)
+	}
+	assertSetSize(t, s, 0)
+}
+
+// TestSelect tests selecting with a predicate and limit
+func TestSelect(t *testing.T) {
+	fmt.Println("TestSelect")
+	var tests = []struct {
+		limit, expected int
+	}{
+		{-1, 10},
+		{0, 0},
+		{5, 5},
+		{20, 10},
+	}
+	s := getPopulatedSet(1, 20)
+	for i, test := range tests {
+		actual := 0
+		for item := range s.Select(testPredicate, test.limit) {
+			if !testPredicate(item) {
+				t.Errorf("Case %d failed, item [%s] didn't pass predicate", i+1, item.Key())
+			}
+			actual++
+		}
+		if actual != test.expected {
+			t.Errorf("Case %d failed, expected %d items, got %d", i+1, test.expected, actual)
+		}
+	}
+}
+
+// TestIterateCtx verifies cancelling the context closes the channel
+func TestIterateCtx(t *testing.T) {
+	fmt.Println("TestIterateCtx")
+	s := getPopulatedSet(1, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := s.IterateCtx(ctx, PredicateAll, -1)
+	<-iter
+	cancel()
+	for range iter {
+	}
+	// the set must be writable once the iteration is abandoned
+	s.Add(testItem{11})
+	assertSetSize(t, s, 11)
+}
+
+// TestIterateAbandoned verifies an undrained channel doesn't block writers
+func TestIterateAbandoned(t *testing.T) {
+	fmt.Println("TestIterateAbandoned")
+	s := getPopulatedSet(1, 10)
+	<-s.IterateAll()
+	s.Add(testItem{11})
+	assertSetSize(t, s, 11)
+}
+
+// TestSnapshot verifies a snapshot is a copy of the set
+func TestSnapshot(t *testing.T) {
+	fmt.Println("TestSnapshot")
+	s := getPopulatedSet(1, 5)
+	snapshot := s.Snapshot()
+	s.Empty()
+	var actual []string
+	for _, item := range snapshot {
+		actual = append(actual, item.Key())
+	}
+	assertKeyArrayEquals(t, []string{"1", "2", "3", "4", "5"}, actual)
+}
+
 func testIterate(t *testing.T, s Set, p Predicate, limit int, expected []string) {
 	var actual []string
 	for i := range s.Iterate(p, limit) {
@@ -0,0 +1,265 @@
+package set
+
+import (
+	"errors"
+	"iter"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrMultisetOverflow when a count or the total of a Multiset would exceed the largest uint64
+	ErrMultisetOverflow = errors.New("multiset count overflows uint64")
+)
+
+// Multiset is a set that counts how many times each Item has been added, also
+// known as a bag. Items are identified by their Key, the first Item added for a
+// Key is the one kept. Like Set it's safe for concurrent use, operations on two
+// Multisets read lock both in a global order so they can't deadlock each other.
+type Multiset struct {
+	mutex sync.RWMutex
+	m     map[string]*counted
+	total uint64
+	seq   uint64
+}
+
+type counted struct {
+	item  Item
+	count uint64
+}
+
+// NewMultiset returns an empty Multiset
+func NewMultiset() *Multiset {
+	return &Multiset{
+		m:   make(map[string]*counted),
+		seq: atomic.AddUint64(&sequence, 1),
+	}
+}
+
+func (ms *Multiset) lock(write bool) {
+	if write {
+		ms.mutex.Lock()
+		return
+	}
+
+	ms.mutex.RLock()
+}
+
+func (ms *Multiset) unlock(write bool) {
+	if write {
+		ms.mutex.Unlock()
+		return
+	}
+
+	ms.mutex.RUnlock()
+}
+
+// rlockBoth read locks ms and other in ascending sequence and returns the function releasing them
+func (ms *Multiset) rlockBoth(other *Multiset) func() {
+	if ms == other {
+		ms.lock(false)
+		return func() { ms.unlock(false) }
+	}
+
+	first, second := ms, other
+	if other.seq < ms.seq {
+		first, second = other, ms
+	}
+	first.lock(false)
+	second.lock(false)
+	return func() {
+		second.unlock(false)
+		first.unlock(false)
+	}
+}
+
+// add returns ErrMultisetOverflow and leaves ms unchanged if the item's count or the total would overflow
+func (ms *Multiset) add(item Item, n uint64) (uint64, error) {
+	current := ms.count(item.Key())
+	if n == 0 {
+		return current, nil
+	}
+	count, carry := bits.Add64(current, n, 0)
+	total, totalCarry := bits.Add64(ms.total, n, 0)
+	if carry != 0 || totalCarry != 0 {
+		return current, ErrMultisetOverflow
+	}
+	c, exists := ms.m[item.Key()]
+	if !exists {
+		c = &counted{item: item}
+		ms.m[item.Key()] = c
+	}
+	c.count, ms.total = count, total
+	return count, nil
+}
+
+func (ms *Multiset) count(key string) uint64 {
+	if c, exists := ms.m[key]; exists {
+		return c.count
+	}
+	return 0
+}
+
+// Add adds n occurrences of item and returns its new count. If the count or the
+// total would overflow it returns ErrMultisetOverflow and the unchanged count.
+func (ms *Multiset) Add(item Item, n uint64) (uint64, error) {
+	ms.lock(true)
+	defer ms.unlock(true)
+
+	return ms.add(item, n)
+}
+
+// Remove removes up to n occurrences of item and returns its new count, the
+// Item is dropped once its count reaches zero
+func (ms *Multiset) Remove(item Item, n uint64) uint64 {
+	ms.lock(true)
+	defer ms.unlock(true)
+
+	c, exists := ms.m[item.Key()]
+	if !exists {
+		return 0
+	}
+	if n >= c.count {
+		ms.total -= c.count
+		delete(ms.m, item.Key())
+		return 0
+	}
+	c.count -= n
+	ms.total -= n
+	return c.count
+}
+
+// Count returns the number of occurrences of item
+func (ms *Multiset) Count(item Item) uint64 {
+	ms.lock(false)
+	defer ms.unlock(false)
+
+	return ms.count(item.Key())
+}
+
+// Contains is true if item occurs at least once
+func (ms *Multiset) Contains(item Item) bool {
+	return ms.Count(item) > 0
+}
+
+// Distinct returns the number of different Items
+func (ms *Multiset) Distinct() int {
+	ms.lock(false)
+	defer ms.unlock(false)
+
+	return len(ms.m)
+}
+
+// Size returns the total number of occurrences of every Item
+func (ms *Multiset) Size() uint64 {
+	ms.lock(false)
+	defer ms.unlock(false)
+
+	return ms.total
+}
+
+// Empty removes every Item
+func (ms *Multiset) Empty() {
+	ms.lock(true)
+	defer ms.unlock(true)
+
+	ms.m = make(map[string]*counted)
+	ms.total = 0
+}
+
+// All iterates a snapshot of every distinct Item and its count
+func (ms *Multiset) All() iter.Seq2[Item, uint64] {
+	return func(yield func(Item, uint64) bool) {
+		ms.lock(false)
+		snapshot := make([]counted, 0, len(ms.m))
+		for _, c := range ms.m {
+			snapshot = append(snapshot, *c)
+		}
+		ms.unlock(false)
+
+		for _, c := range snapshot {
+			if !yield(c.item, c.count) {
+				return
+			}
+		}
+	}
+}
+
+// ToSet returns a Set of the distinct Items
+func (ms *Multiset) ToSet() Set {
+	ms.lock(false)
+	defer ms.unlock(false)
+
+	s := NewSet()
+	for key, c := range ms.m {
+		s.data()[key] = c.item
+	}
+	return s
+}
+
+// combine builds a new Multiset with count(key) for every key in ms or other,
+// Items from ms are taken first. count returns false if the count overflows.
+func (ms *Multiset) combine(other *Multiset, count func(a, b uint64) (uint64, bool)) (*Multiset, error) {
+	defer ms.rlockBoth(other)()
+
+	result := NewMultiset()
+	add := func(item Item, a, b uint64) error {
+		n, ok := count(a, b)
+		if !ok {
+			return ErrMultisetOverflow
+		}
+		_, err := result.add(item, n)
+		return err
+	}
+	for key, c := range ms.m {
+		if err := add(c.item, c.count, other.count(key)); err != nil {
+			return nil, err
+		}
+	}
+	for key, c := range other.m {
+		if _, exists := ms.m[key]; !exists {
+			if err := add(c.item, 0, c.count); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// combineBounded is combine for counts that can't be larger than ms's, so neither they nor the total can overflow
+func (ms *Multiset) combineBounded(other *Multiset, count func(a, b uint64) uint64) *Multiset {
+	result, _ := ms.combine(other, func(a, b uint64) (uint64, bool) { return count(a, b), true })
+	return result
+}
+
+// Union returns the multiset union, where each Item's count is the larger of its
+// two counts. If the total would overflow it returns ErrMultisetOverflow.
+func (ms *Multiset) Union(other *Multiset) (*Multiset, error) {
+	return ms.combine(other, func(a, b uint64) (uint64, bool) { return max(a, b), true })
+}
+
+// Sum returns the multiset sum, where each Item's count is the sum of its two
+// counts. If a count or the total would overflow it returns ErrMultisetOverflow.
+func (ms *Multiset) Sum(other *Multiset) (*Multiset, error) {
+	return ms.combine(other, func(a, b uint64) (uint64, bool) {
+		sum, carry := bits.Add64(a, b, 0)
+		return sum, carry == 0
+	})
+}
+
+// Intersection returns the multiset intersection, where each Item's count is the smaller of its two counts
+func (ms *Multiset) Intersection(other *Multiset) *Multiset {
+	return ms.combineBounded(other, func(a, b uint64) uint64 { return min(a, b) })
+}
+
+// Difference returns the multiset difference, where each Item's count is its
+// count in ms less its count in other, or zero
+func (ms *Multiset) Difference(other *Multiset) *Multiset {
+	return ms.combineBounded(other, func(a, b uint64) uint64 {
+		if b >= a {
+			return 0
+		}
+		return a - b
+	})
+}
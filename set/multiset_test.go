@@ -0,0 +1,127 @@
+package set
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// getPopulatedMultiset adds counts[i] occurrences of testItem{i+1}
+func getPopulatedMultiset(counts ...uint64) *Multiset {
+	ms := NewMultiset()
+	for i, n := range counts {
+		ms.Add(testItem{i + 1}, n)
+	}
+	return ms
+}
+
+func assertCounts(t *testing.T, msg string, ms *Multiset, expected ...uint64) {
+	var total uint64
+	distinct := 0
+	for i, n := range expected {
+		if count := ms.Count(testItem{i + 1}); count != n {
+			t.Errorf("%s -- expected count of %d to be %d, got %d", msg, i+1, n, count)
+		}
+		total += n
+		if n > 0 {
+			distinct++
+		}
+	}
+	if ms.Size() != total || ms.Distinct() != distinct {
+		t.Errorf("%s -- expected size %d and %d distinct, got %d and %d", msg, total, distinct, ms.Size(), ms.Distinct())
+	}
+}
+
+func TestMultisetAddRemove(t *testing.T) {
+	fmt.Println("TestMultisetAddRemove")
+	ms := NewMultiset()
+	adds := []struct {
+		item     int
+		n        uint64
+		expected uint64
+	}{{1, 3, 3}, {1, 2, 5}, {2, 0, 0}}
+	for _, add := range adds {
+		count, err := ms.Add(testItem{add.item}, add.n)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		assertOperation(t, fmt.Sprintf("add %d of %d returns %d", add.n, add.item, add.expected), count == add.expected, true)
+	}
+	assertCounts(t, "after adds", ms, 5, 0)
+
+	assertOperation(t, "remove 2 returns 3", ms.Remove(testItem{1}, 2) == 3, true)
+	assertOperation(t, "remove missing item returns 0", ms.Remove(testItem{2}, 1) == 0, true)
+	assertCounts(t, "after remove", ms, 3)
+	assertOperation(t, "removing more than present returns 0", ms.Remove(testItem{1}, 10) == 0, true)
+	assertOperation(t, "item is gone", ms.Contains(testItem{1}), false)
+	assertCounts(t, "after removing everything", ms)
+
+	ms.Add(testItem{1}, 1)
+	ms.Empty()
+	assertCounts(t, "after empty", ms)
+}
+
+func TestMultisetOperations(t *testing.T) {
+	fmt.Println("TestMultisetOperations")
+	a, b := getPopulatedMultiset(3, 1, 0, 2), getPopulatedMultiset(1, 4, 2)
+	union, _ := a.Union(b)
+	assertCounts(t, "union", union, 3, 4, 2, 2)
+	sum, _ := a.Sum(b)
+	assertCounts(t, "sum", sum, 4, 5, 2, 2)
+	assertCounts(t, "intersection", a.Intersection(b), 1, 1, 0, 0)
+	assertCounts(t, "difference", a.Difference(b), 2, 0, 0, 2)
+	assertCounts(t, "reverse difference", b.Difference(a), 0, 3, 2)
+	sum, _ = a.Sum(a)
+	assertCounts(t, "sum with self", sum, 6, 2, 0, 4)
+}
+
+func TestMultisetOverflow(t *testing.T) {
+	fmt.Println("TestMultisetOverflow")
+	ms := getPopulatedMultiset(math.MaxUint64 - 1)
+	if count, err := ms.Add(testItem{1}, 2); err != ErrMultisetOverflow || count != math.MaxUint64-1 {
+		t.Errorf("Expected error %s and the unchanged count, got [%v] and %d", ErrMultisetOverflow, err, count)
+	}
+	if _, err := ms.Add(testItem{2}, 2); err != ErrMultisetOverflow {
+		t.Errorf("Expected error %s when the total overflows, got [%v] instead", ErrMultisetOverflow, err)
+	}
+	assertCounts(t, "after failed adds", ms, math.MaxUint64-1)
+	if count, err := ms.Add(testItem{1}, 1); err != nil || count != math.MaxUint64 {
+		t.Errorf("Expected to reach the largest count, got [%v] and %d", err, count)
+	}
+
+	if _, err := ms.Sum(getPopulatedMultiset(1)); err != ErrMultisetOverflow {
+		t.Errorf("sum: expected error %s, got [%v] instead", ErrMultisetOverflow, err)
+	}
+	if _, err := ms.Union(getPopulatedMultiset(0, 1)); err != ErrMultisetOverflow {
+		t.Errorf("union: expected error %s, got [%v] instead", ErrMultisetOverflow, err)
+	}
+	assertCounts(t, "intersection", ms.Intersection(getPopulatedMultiset(5)), 5)
+}
+
+func TestMultisetAll(t *testing.T) {
+	fmt.Println("TestMultisetAll")
+	ms := getPopulatedMultiset(3, 1, 2)
+	counts := make(map[string]uint64)
+	for item, count := range ms.All() {
+		counts[item.Key()] = count
+		ms.Remove(item, count)
+	}
+	assertIntsEqual(t, "iterated counts", []int{3, 1, 2}, []int{int(counts["1"]), int(counts["2"]), int(counts["3"])})
+	assertCounts(t, "removed while iterating", ms)
+	assertOperation(t, "distinct items as a set", Equal(getPopulatedMultiset(3, 1, 2).ToSet(), getPopulatedSet(1, 3)), true)
+}
+
+func TestMultisetConcurrent(t *testing.T) {
+	fmt.Println("TestMultisetConcurrent")
+	m1, m2 := NewMultiset(), NewMultiset()
+	stress(t, func(worker, i int) {
+		a, b := m1, m2
+		if worker%2 == 1 {
+			a, b = m2, m1
+		}
+		a.Add(testItem{i % 10}, 2)
+		a.Union(b)
+		a.Difference(b)
+		b.Remove(testItem{i % 10}, 1)
+	})
+}
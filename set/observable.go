@@ -0,0 +1,205 @@
+package set
+
+import (
+	"context"
+	"sync"
+)
+
+// Event describes a change to an ObservableSet. Single Adds and Removes publish
+// an Event with one Item, bulk operations like UnionWith or Empty publish a
+// single Event with every Item they changed.
+type Event struct {
+	Added   []Item
+	Removed []Item
+}
+
+// ObservableSet is a Set that publishes an Event to its subscribers after every
+// change. Events are published in the order the changes were made.
+type ObservableSet interface {
+	Set
+
+	// Subscribe registers fn to be called with every Event and returns the
+	// function that unregisters it. fn is called synchronously while the set
+	// is being changed, so it must be quick and mustn't change the set itself.
+	Subscribe(fn func(Event)) (unsubscribe func())
+	// Events returns a channel receiving every Event until ctx is done, when
+	// it's closed. Events are buffered for as long as the receiver needs, so a
+	// slow receiver never holds up changes to the set.
+	Events(ctx context.Context) <-chan Event
+}
+
+// NewObservableSet wraps s so changes made through the returned set are
+// published, changes made to s directly are not
+func NewObservableSet(s Set) ObservableSet {
+	return &observableSet{
+		Set:         s,
+		subscribers: make(map[int]func(Event)),
+	}
+}
+
+// observableSet serializes changes with mutex so each change and its Event are
+// published before the next change is made
+type observableSet struct {
+	Set
+	mutex       sync.Mutex
+	subscribers map[int]func(Event)
+	next        int
+}
+
+func (o *observableSet) Subscribe(fn func(Event)) func() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	id := o.next
+	o.next++
+	o.subscribers[id] = fn
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+
+		delete(o.subscribers, id)
+	}
+}
+
+func (o *observableSet) Events(ctx context.Context) <-chan Event {
+	ch := make(chan Event)
+	var mutex sync.Mutex
+	var pending []Event
+	wake := make(chan struct{}, 1)
+	unsubscribe := o.Subscribe(func(e Event) {
+		mutex.Lock()
+		pending = append(pending, e)
+		mutex.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(ch)
+		defer unsubscribe()
+		for {
+			mutex.Lock()
+			events := pending
+			pending = nil
+			mutex.Unlock()
+
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// publish sends e to every subscriber if anything changed, callers must hold the mutex
+func (o *observableSet) publish(e Event) {
+	if len(e.Added) == 0 && len(e.Removed) == 0 {
+		return
+	}
+	for _, fn := range o.subscribers {
+		fn(e)
+	}
+}
+
+func (o *observableSet) Add(item Item) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	added := o.Set.Add(item)
+	if added {
+		o.publish(Event{Added: []Item{item}})
+	}
+	return added
+}
+
+func (o *observableSet) Remove(item Item) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	existing, _ := o.Set.Get(item)
+	removed := o.Set.Remove(item)
+	if removed {
+		o.publish(Event{Removed: []Item{existing}})
+	}
+	return removed
+}
+
+func (o *observableSet) Empty() {
+	o.RemoveIf(PredicateAll)
+}
+
+// UnionWith adds the Items of a snapshot of other one at a time, so exactly
+// the ones that were added are published
+func (o *observableSet) UnionWith(other Set) int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var added []Item
+	for _, item := range other.Snapshot() {
+		if o.Set.Add(item) {
+			added = append(added, item)
+		}
+	}
+	o.publish(Event{Added: added})
+	return len(added)
+}
+
+func (o *observableSet) IntersectWith(other Set) int {
+	keep := make(map[string]bool)
+	for _, item := range other.Snapshot() {
+		keep[item.Key()] = true
+	}
+	return o.RemoveIf(func(item Item) bool {
+		return !keep[item.Key()]
+	})
+}
+
+func (o *observableSet) DifferenceWith(other Set) int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var removed []Item
+	for _, item := range other.Snapshot() {
+		existing, _ := o.Set.Get(item)
+		if o.Set.Remove(item) {
+			removed = append(removed, existing)
+		}
+	}
+	o.publish(Event{Removed: removed})
+	return len(removed)
+}
+
+func (o *observableSet) RetainIf(pred Predicate) int {
+	return o.RemoveIf(func(item Item) bool {
+		return !pred(item)
+	})
+}
+
+// RemoveIf records the Items the predicate matched, since those are the ones the underlying set removes
+func (o *observableSet) RemoveIf(pred Predicate) int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var removed []Item
+	o.Set.RemoveIf(func(item Item) bool {
+		if pred(item) {
+			removed = append(removed, item)
+			return true
+		}
+		return false
+	})
+	o.publish(Event{Removed: removed})
+	return len(removed)
+}
@@ -0,0 +1,131 @@
+package set
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func eventKeys(items []Item) []int {
+	var keys []int
+	for _, item := range items {
+		keys = append(keys, item.(testItem).i)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func TestObservableEvents(t *testing.T) {
+	fmt.Println("TestObservableEvents")
+	o := NewObservableSet(NewSet())
+	var events []Event
+	unsubscribe := o.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+
+	o.Add(testItem{1})
+	o.Add(testItem{1})
+	o.UnionWith(getPopulatedSet(1, 5))
+	o.Remove(testItem{2})
+	o.Remove(testItem{2})
+	o.DifferenceWith(getPopulatedSet(3, 3))
+	o.IntersectWith(getPopulatedSet(4, 10))
+	o.RetainIf(testPredicate)
+	o.Empty()
+	o.Empty()
+
+	var tests = []struct {
+		added, removed []int
+	}{
+		{[]int{1}, nil},
+		{[]int{2, 3, 4, 5}, nil},
+		{nil, []int{2}},
+		{nil, []int{3}},
+		{nil, []int{1}},
+		{nil, []int{4}},
+		{nil, []int{5}},
+	}
+	if len(events) != len(tests) {
+		t.Fatalf("Expected %d events, got %d", len(tests), len(events))
+	}
+	for i, test := range tests {
+		assertIntsEqual(t, fmt.Sprintf("event %d added", i+1), test.added, eventKeys(events[i].Added))
+		assertIntsEqual(t, fmt.Sprintf("event %d removed", i+1), test.removed, eventKeys(events[i].Removed))
+	}
+
+	unsubscribe()
+	o.Add(testItem{1})
+	if len(events) != len(tests) {
+		t.Errorf("Did not expect events after unsubscribing")
+	}
+}
+
+func TestObservableChannel(t *testing.T) {
+	fmt.Println("TestObservableChannel")
+	o := NewObservableSet(NewOrderedSet(testComparator))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := o.Events(ctx)
+
+	// nothing is receiving yet, changes must not block on the channel
+	for i := 1; i <= 100; i++ {
+		o.Add(testItem{i})
+	}
+	o.Empty()
+
+	for i := 1; i <= 100; i++ {
+		e := <-events
+		assertIntsEqual(t, "added in order", []int{i}, eventKeys(e.Added))
+	}
+	e := <-events
+	if len(e.Removed) != 100 {
+		t.Errorf("Expected Empty to publish one event with 100 items, got %d", len(e.Removed))
+	}
+
+	cancel()
+	select {
+	case _, open := <-events:
+		if open {
+			t.Errorf("Did not expect another event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the channel to be closed after cancelling")
+	}
+	o.Add(testItem{101})
+}
+
+func TestObservableConcurrent(t *testing.T) {
+	fmt.Println("TestObservableConcurrent")
+	o := NewObservableSet(NewSet())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := o.Events(ctx)
+
+	stress(t, func(worker, i int) {
+		o.Add(testItem{i % 20})
+		o.Remove(testItem{(i + worker) % 20})
+		if i%100 == 0 {
+			o.UnionWith(getPopulatedSet(0, 19))
+		}
+	})
+	o.Add(testItem{1000})
+
+	// every change was published, so replaying the events rebuilds the set
+	replayed := NewSet()
+	timeout := time.After(10 * time.Second)
+	for !replayed.Contains(testItem{1000}) {
+		select {
+		case e := <-events:
+			for _, item := range e.Added {
+				replayed.Add(item)
+			}
+			for _, item := range e.Removed {
+				replayed.Remove(item)
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for events")
+		}
+	}
+	assertOperation(t, "replayed events match the set", Equal(replayed, o), true)
+}
@@ -0,0 +1,164 @@
+package set
+
+import (
+	"errors"
+	"iter"
+)
+
+// MaxPowerSetSize is the largest Set PowerSet will enumerate, it has 2^MaxPowerSetSize subsets
+const MaxPowerSetSize = 32
+
+var (
+	// ErrPowerSetTooLarge when PowerSet is invoked with a Set larger than MaxPowerSetSize
+	ErrPowerSetTooLarge = errors.New("set is too large to enumerate its power set")
+)
+
+// UnionAll returns the union of every set, the values of earlier sets are taken first
+func UnionAll(many ...Set) (Set, error) {
+	defer rlockAll(many...)()
+
+	union := NewSet()
+	for _, s := range many {
+		for key, item := range s.data() {
+			if _, exists := union.data()[key]; exists {
+				continue
+			}
+			union.data()[key] = item
+		}
+	}
+	return union, nil
+}
+
+// IntersectionAll returns a set containing the items common to every set, with
+// the values of the first set. The intersection of no sets is empty.
+func IntersectionAll(many ...Set) (Set, error) {
+	defer rlockAll(many...)()
+
+	intersection := NewSet()
+	if len(many) == 0 {
+		return intersection, nil
+	}
+
+	maps := make([]map[string]Item, len(many))
+	smallest := 0
+	for i, s := range many {
+		maps[i] = s.data()
+		if len(maps[i]) < len(maps[smallest]) {
+			smallest = i
+		}
+	}
+	for key := range maps[smallest] {
+		if inAll(key, maps) {
+			intersection.data()[key] = maps[0][key]
+		}
+	}
+	return intersection, nil
+}
+
+func inAll(key string, maps []map[string]Item) bool {
+	for _, m := range maps {
+		if _, exists := m[key]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// SymmetricDifference returns the items that are in exactly one of s1 and s2
+func SymmetricDifference(s1, s2 Set) (Set, error) {
+	defer rlockAll(s1, s2)()
+
+	m1, m2, diff := s1.data(), s2.data(), NewSet()
+	for key, item := range m1 {
+		if _, exists := m2[key]; !exists {
+			diff.data()[key] = item
+		}
+	}
+	for key, item := range m2 {
+		if _, exists := m1[key]; !exists {
+			diff.data()[key] = item
+		}
+	}
+	return diff, nil
+}
+
+// Disjoint is true if s1 and s2 have no items in common
+func Disjoint(s1, s2 Set) bool {
+	defer rlockAll(s1, s2)()
+
+	smaller, larger := s1.data(), s2.data()
+	if len(smaller) > len(larger) {
+		smaller, larger = larger, smaller
+	}
+	for key := range smaller {
+		if _, exists := larger[key]; exists {
+			return false
+		}
+	}
+	return true
+}
+
+// Partition splits s into the items matching the predicate and the items that don't
+func Partition(p Predicate, s Set) (Set, Set, error) {
+	defer rlockAll(s)()
+
+	matching, rest := NewSet(), NewSet()
+	for key, item := range s.data() {
+		if p(item) {
+			matching.data()[key] = item
+			continue
+		}
+		rest.data()[key] = item
+	}
+	return matching, rest, nil
+}
+
+// CartesianProduct yields every (s1 item, s2 item) pair. The pairs come from
+// snapshots of both sets taken when the iteration starts.
+func CartesianProduct(s1, s2 Set) iter.Seq2[Item, Item] {
+	return func(yield func(Item, Item) bool) {
+		unlock := rlockAll(s1, s2)
+		items1, items2 := values(s1.data()), values(s2.data())
+		unlock()
+
+		for _, i1 := range items1 {
+			for _, i2 := range items2 {
+				if !yield(i1, i2) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// PowerSet lazily yields every subset of s, starting with the empty set. The
+// subsets are built from a snapshot of s taken when PowerSet is called, and sets
+// with more than MaxPowerSetSize items return ErrPowerSetTooLarge.
+func PowerSet(s Set) (iter.Seq[Set], error) {
+	items := s.Snapshot()
+	if len(items) > MaxPowerSetSize {
+		return nil, ErrPowerSetTooLarge
+	}
+
+	return func(yield func(Set) bool) {
+		for mask := uint64(0); mask < uint64(1)<<uint(len(items)); mask++ {
+			subset := NewSet()
+			for i, item := range items {
+				if mask&(uint64(1)<<uint(i)) != 0 {
+					subset.data()[item.Key()] = item
+				}
+			}
+			if !yield(subset) {
+				return
+			}
+		}
+	}, nil
+}
+
+func values(m map[string]Item) []Item {
+	items := make([]Item, 0, len(m))
+	for _, item := range m {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,182 @@
+package set
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnionAll(t *testing.T) {
+	fmt.Println("TestUnionAll")
+	var tests = []struct {
+		many     []Set
+		expected []int
+	}{
+		{[]Set{}, []int{}},
+		{[]Set{getPopulatedSet(1, 3)}, []int{1, 2, 3}},
+		{[]Set{getPopulatedSet(1, 3), getPopulatedSet(2, 5), getPopulatedSet(9, 10)}, []int{1, 2, 3, 4, 5, 9, 10}},
+	}
+	for i, test := range tests {
+		u, err := UnionAll(test.many...)
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		assertSetSize(t, u, len(test.expected))
+		assertSetContainsItems(t, u, test.expected)
+	}
+}
+
+func TestUnionAllPrecedence(t *testing.T) {
+	fmt.Println("TestUnionAllPrecedence")
+	s1, s2 := getTestSet(), getTestSet()
+	populateSetItem2(s1, 1, 5, func(i int) int { return 1 })
+	populateSetItem2(s2, 1, 5, func(i int) int { return 2 })
+	u, _ := UnionAll(s1, s2)
+	for item := range u.All() {
+		if item.(testItem2).extra != 1 {
+			t.Errorf("Expected item %s to come from the first set", item.Key())
+		}
+	}
+}
+
+func TestIntersectionAll(t *testing.T) {
+	fmt.Println("TestIntersectionAll")
+	var tests = []struct {
+		many     []Set
+		expected []int
+	}{
+		{[]Set{}, []int{}},
+		{[]Set{getPopulatedSet(1, 3)}, []int{1, 2, 3}},
+		{[]Set{getPopulatedSet(1, 10), getPopulatedSet(3, 8), getPopulatedSet(5, 20)}, []int{5, 6, 7, 8}},
+		{[]Set{getPopulatedSet(1, 10), getPopulatedSet(3, 8), getPopulatedSet(11, 20)}, []int{}},
+	}
+	for i, test := range tests {
+		x, err := IntersectionAll(test.many...)
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		assertSetSize(t, x, len(test.expected))
+		assertSetContainsItems(t, x, test.expected)
+	}
+}
+
+func TestSymmetricDifference(t *testing.T) {
+	fmt.Println("TestSymmetricDifference")
+	var tests = []struct {
+		setArgs, expected []int
+	}{
+		{setArgs: []int{1, 10, 1, 10}, expected: []int{}},
+		{setArgs: []int{1, 5, 4, 7}, expected: []int{1, 2, 3, 6, 7}},
+		{setArgs: []int{1, 2, 3, 4}, expected: []int{1, 2, 3, 4}},
+		{setArgs: []int{1, 0, 1, 2}, expected: []int{1, 2}},
+	}
+	for i, test := range tests {
+		s1 := getPopulatedSet(test.setArgs[0], test.setArgs[1])
+		s2 := getPopulatedSet(test.setArgs[2], test.setArgs[3])
+		d, err := SymmetricDifference(s1, s2)
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		assertSetSize(t, d, len(test.expected))
+		assertSetContainsItems(t, d, test.expected)
+	}
+}
+
+func TestDisjoint(t *testing.T) {
+	fmt.Println("TestDisjoint")
+	var tests = []struct {
+		disjoint bool
+		s1, s2   Set
+	}{
+		{true, getPopulatedSet(1, 5), getPopulatedSet(6, 10)},
+		{true, getPopulatedSet(1, 0), getPopulatedSet(1, 0)},
+		{true, getPopulatedSet(1, 5), getPopulatedSet(1, 0)},
+		{false, getPopulatedSet(1, 5), getPopulatedSet(5, 10)},
+		{false, getPopulatedSet(1, 5), getPopulatedSet(1, 5)},
+	}
+	for i, test := range tests {
+		if Disjoint(test.s1, test.s2) != test.disjoint {
+			t.Errorf("Case %d failed, expected disjoint %t, got %t", i+1, test.disjoint, !test.disjoint)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	fmt.Println("TestPartition")
+	matching, rest, err := Partition(testPredicate, getPopulatedSet(1, 10))
+	if err != nil {
+		t.Error(err)
+	}
+	assertSetSize(t, matching, 5)
+	assertSetContainsItems(t, matching, []int{1, 3, 5, 7, 9})
+	assertSetSize(t, rest, 5)
+	assertSetContainsItems(t, rest, []int{2, 4, 6, 8, 10})
+}
+
+func TestCartesianProduct(t *testing.T) {
+	fmt.Println("TestCartesianProduct")
+	var actual []string
+	for i1, i2 := range CartesianProduct(getPopulatedSet(1, 2), getPopulatedSet(3, 5)) {
+		actual = append(actual, i1.Key()+"x"+i2.Key())
+	}
+	assertKeyArrayEquals(t, []string{"1x3", "1x4", "1x5", "2x3", "2x4", "2x5"}, actual)
+
+	pairs := 0
+	for range CartesianProduct(getPopulatedSet(1, 10), getPopulatedSet(1, 10)) {
+		pairs++
+		if pairs == 3 {
+			break
+		}
+	}
+	if pairs != 3 {
+		t.Errorf("Expected to stop after 3 pairs, got %d", pairs)
+	}
+}
+
+func TestPowerSet(t *testing.T) {
+	fmt.Println("TestPowerSet")
+	var tests = []struct {
+		end, subsets int
+	}{
+		{0, 1},
+		{1, 2},
+		{3, 8},
+		{10, 1024},
+	}
+	for i, test := range tests {
+		ps, err := PowerSet(getPopulatedSet(1, test.end))
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		seen := NewSet()
+		for subset := range ps {
+			if !Subset(getPopulatedSet(1, test.end), subset) {
+				t.Errorf("Case %d failed, power set yielded a set that isn't a subset", i+1)
+			}
+			seen.Add(setMask(subset))
+		}
+		assertSetSize(t, seen, test.subsets)
+	}
+}
+
+func TestPowerSetTooLarge(t *testing.T) {
+	fmt.Println("TestPowerSetTooLarge")
+	_, err := PowerSet(getPopulatedSet(1, MaxPowerSetSize+1))
+	if err != ErrPowerSetTooLarge {
+		t.Errorf("Expected error %s, got [%s] instead", ErrPowerSetTooLarge, err)
+	}
+}
+
+// maskItem identifies a set of testItems less than 64 by a bitmask
+type maskItem uint64
+
+func (m maskItem) Key() string {
+	return fmt.Sprint(uint64(m))
+}
+
+func setMask(s Set) maskItem {
+	var m maskItem
+	for item := range s.All() {
+		m |= 1 << uint(item.(testItem).i)
+	}
+	return m
+}
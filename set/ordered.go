@@ -0,0 +1,421 @@
+package set
+
+import (
+	"context"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// OrderedSet is a Set that keeps its Items sorted by a Comparator
+//
+// Items are still identified by their Key, the Comparator only decides their
+// order. It has to be consistent with Key: two Items compare as equal if and
+// only if they have the same Key. Only the sign of a Comparison is used, so a
+// Comparator can return any negative or positive value for less or greater.
+//
+// Snapshot, All, Select and the channel iterators all yield Items in ascending order.
+type OrderedSet interface {
+	Set
+
+	// Min returns the smallest Item
+	Min() (Item, bool)
+	// Max returns the largest Item
+	Max() (Item, bool)
+	// Floor returns the largest Item less than or equal to item
+	Floor(item Item) (Item, bool)
+	// Ceiling returns the smallest Item greater than or equal to item
+	Ceiling(item Item) (Item, bool)
+	// RangeBetween iterates the Items between lo and hi inclusive in ascending order
+	RangeBetween(lo, hi Item) iter.Seq[Item]
+	// Rank returns the number of Items less than item
+	Rank(item Item) int
+	// SelectKth returns the kth smallest Item counting from 0, it's named so
+	// it doesn't collide with Set's Select
+	SelectKth(k int) (Item, bool)
+	// Ascending iterates the Items from smallest to largest
+	Ascending() iter.Seq[Item]
+	// Descending iterates the Items from largest to smallest
+	Descending() iter.Seq[Item]
+}
+
+// NewOrderedSet returns an OrderedSet sorted by comp, backed by an AVL tree
+func NewOrderedSet(comp Comparator) OrderedSet {
+	return &orderedSet{
+		m:     make(map[string]Item),
+		comp:  comp,
+		mutex: &sync.RWMutex{},
+		seq:   atomic.AddUint64(&sequence, 1),
+	}
+}
+
+// orderedSet indexes its Items both by Key, which the package level operations
+// rely on through data(), and by order in the tree
+type orderedSet struct {
+	mutex *sync.RWMutex
+	m     map[string]Item
+	root  *node
+	comp  Comparator
+	seq   uint64
+}
+
+func (s *orderedSet) data() map[string]Item {
+	return s.m
+}
+
+func (s *orderedSet) lock(write bool) {
+	if write {
+		s.mutex.Lock()
+		return
+	}
+
+	s.mutex.RLock()
+}
+
+func (s *orderedSet) unlock(write bool) {
+	if write {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.mutex.RUnlock()
+}
+
+func (s *orderedSet) order() uint64 {
+	return s.seq
+}
+
+// add inserts item, callers must hold the write lock
+func (s *orderedSet) add(item Item) bool {
+	if _, exists := s.m[item.Key()]; exists {
+		return false
+	}
+
+	root, inserted := insert(s.root, item, s.comp)
+	if !inserted {
+		// an Item with a different Key compared equal, the Comparator isn't consistent with Key
+		return false
+	}
+	s.root = root
+	s.m[item.Key()] = item
+	return true
+}
+
+// remove deletes the Item with item's Key, callers must hold the write lock
+func (s *orderedSet) remove(item Item) bool {
+	existing, exists := s.m[item.Key()]
+	if !exists {
+		return false
+	}
+
+	s.root, _ = remove(s.root, existing, s.comp)
+	delete(s.m, item.Key())
+	return true
+}
+
+func (s *orderedSet) Get(item Item) (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
+	value, exists := s.m[item.Key()]
+	return value, exists
+}
+
+func (s *orderedSet) Add(item Item) bool {
+	s.lock(true)
+	defer s.unlock(true)
+
+	return s.add(item)
+}
+
+func (s *orderedSet) Remove(item Item) bool {
+	s.lock(true)
+	defer s.unlock(true)
+
+	return s.remove(item)
+}
+
+func (s *orderedSet) Contains(item Item) bool {
+	s.lock(false)
+	defer s.unlock(false)
+
+	_, exists := s.m[item.Key()]
+	return exists
+}
+
+func (s *orderedSet) Empty() {
+	s.lock(true)
+	defer s.unlock(true)
+
+	s.m = make(map[string]Item)
+	s.root = nil
+}
+
+func (s *orderedSet) Size() int {
+	s.lock(false)
+	defer s.unlock(false)
+
+	return len(s.m)
+}
+
+func (s *orderedSet) UnionWith(other Set) int {
+	defer lockWith(s, other)()
+
+	added := 0
+	for _, item := range other.data() {
+		if s.add(item) {
+			added++
+		}
+	}
+	return added
+}
+
+func (s *orderedSet) IntersectWith(other Set) int {
+	defer lockWith(s, other)()
+
+	keep := other.data()
+	return s.removeIf(func(item Item) bool {
+		_, exists := keep[item.Key()]
+		return !exists
+	})
+}
+
+func (s *orderedSet) DifferenceWith(other Set) int {
+	defer lockWith(s, other)()
+
+	if other.order() == s.order() {
+		removed := len(s.m)
+		s.m = make(map[string]Item)
+		s.root = nil
+		return removed
+	}
+
+	removed := 0
+	for _, item := range other.data() {
+		if s.remove(item) {
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *orderedSet) RetainIf(pred Predicate) int {
+	return s.RemoveIf(func(item Item) bool {
+		return !pred(item)
+	})
+}
+
+func (s *orderedSet) RemoveIf(pred Predicate) int {
+	s.lock(true)
+	defer s.unlock(true)
+
+	return s.removeIf(pred)
+}
+
+// removeIf collects the matching Items before removing them so the tree isn't
+// modified while it's being walked
+func (s *orderedSet) removeIf(pred Predicate) int {
+	var matching []Item
+	ascend(s.root, func(item Item) bool {
+		if pred(item) {
+			matching = append(matching, item)
+		}
+		return true
+	})
+	for _, item := range matching {
+		s.remove(item)
+	}
+	return len(matching)
+}
+
+// snapshot collects up to limit Items matching pred in ascending order, a negative limit means no limit
+func (s *orderedSet) snapshot(pred Predicate, limit int) []Item {
+	s.lock(false)
+	defer s.unlock(false)
+
+	items := make([]Item, 0, len(s.m))
+	ascend(s.root, func(item Item) bool {
+		if len(items) == limit {
+			return false
+		}
+		if pred(item) {
+			items = append(items, item)
+		}
+		return true
+	})
+	return items
+}
+
+func (s *orderedSet) Snapshot() []Item {
+	return s.snapshot(PredicateAll, -1)
+}
+
+func (s *orderedSet) All() iter.Seq[Item] {
+	return s.Ascending()
+}
+
+func (s *orderedSet) Select(pred Predicate, limit int) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		yieldAll(s.snapshot(pred, limit), yield)
+	}
+}
+
+func (s *orderedSet) IterateCtx(ctx context.Context, pred Predicate, limit int) <-chan Item {
+	return sendAll(ctx, s.snapshot(pred, limit))
+}
+
+// Deprecated: the sending goroutine leaks unless the channel is drained, use All or IterateCtx
+func (s *orderedSet) IterateAll() <-chan Item {
+	return s.IterateCtx(context.Background(), PredicateAll, -1)
+}
+
+// Deprecated: the sending goroutine leaks unless the channel is drained, use Select or IterateCtx
+func (s *orderedSet) Iterate(pred Predicate, limit int) <-chan Item {
+	return s.IterateCtx(context.Background(), pred, limit)
+}
+
+func (s *orderedSet) Ascending() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		yieldAll(s.snapshot(PredicateAll, -1), yield)
+	}
+}
+
+func (s *orderedSet) Descending() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		s.lock(false)
+		items := make([]Item, 0, len(s.m))
+		descend(s.root, func(item Item) bool {
+			items = append(items, item)
+			return true
+		})
+		s.unlock(false)
+
+		yieldAll(items, yield)
+	}
+}
+
+func (s *orderedSet) RangeBetween(lo, hi Item) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		s.lock(false)
+		var items []Item
+		ascendRange(s.root, lo, hi, s.comp, func(item Item) bool {
+			items = append(items, item)
+			return true
+		})
+		s.unlock(false)
+
+		yieldAll(items, yield)
+	}
+}
+
+func (s *orderedSet) Min() (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
+	if s.root == nil {
+		return nil, false
+	}
+	n := s.root
+	for n.left != nil {
+		n = n.left
+	}
+	return n.item, true
+}
+
+func (s *orderedSet) Max() (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
+	if s.root == nil {
+		return nil, false
+	}
+	n := s.root
+	for n.right != nil {
+		n = n.right
+	}
+	return n.item, true
+}
+
+func (s *orderedSet) Floor(item Item) (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
+	var floor *node
+	for n := s.root; n != nil; {
+		switch c := s.comp(item, n.item); {
+		case c < equal:
+			n = n.left
+		case c > equal:
+			floor = n
+			n = n.right
+		default:
+			return n.item, true
+		}
+	}
+	if floor == nil {
+		return nil, false
+	}
+	return floor.item, true
+}
+
+func (s *orderedSet) Ceiling(item Item) (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
+	var ceiling *node
+	for n := s.root; n != nil; {
+		switch c := s.comp(item, n.item); {
+		case c < equal:
+			ceiling = n
+			n = n.left
+		case c > equal:
+			n = n.right
+		default:
+			return n.item, true
+		}
+	}
+	if ceiling == nil {
+		return nil, false
+	}
+	return ceiling.item, true
+}
+
+func (s *orderedSet) Rank(item Item) int {
+	s.lock(false)
+	defer s.unlock(false)
+
+	rank := 0
+	for n := s.root; n != nil; {
+		switch c := s.comp(item, n.item); {
+		case c < equal:
+			n = n.left
+		case c > equal:
+			rank += size(n.left) + 1
+			n = n.right
+		default:
+			return rank + size(n.left)
+		}
+	}
+	return rank
+}
+
+func (s *orderedSet) SelectKth(k int) (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
+	if k < 0 || k >= size(s.root) {
+		return nil, false
+	}
+	n := s.root
+	for {
+		switch left := size(n.left); {
+		case k < left:
+			n = n.left
+		case k > left:
+			k -= left + 1
+			n = n.right
+		default:
+			return n.item, true
+		}
+	}
+}
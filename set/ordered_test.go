@@ -0,0 +1,178 @@
+package set
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+var testComparator = func(i1, i2 Item) Comparison {
+	n1, n2 := i1.(testItem).i, i2.(testItem).i
+	switch {
+	case n1 < n2:
+		return lessThan
+	case n1 > n2:
+		return greaterThan
+	}
+	return equal
+}
+
+func getPopulatedOrderedSet(values ...int) OrderedSet {
+	s := NewOrderedSet(testComparator)
+	for _, v := range values {
+		s.Add(testItem{v})
+	}
+	return s
+}
+
+func orderedKeys(seq func(func(Item) bool)) []int {
+	var keys []int
+	for item := range seq {
+		keys = append(keys, item.(testItem).i)
+	}
+	return keys
+}
+
+func assertIntsEqual(t *testing.T, msg string, expected, actual []int) {
+	if fmt.Sprint(expected) != fmt.Sprint(actual) {
+		t.Errorf("%s -- expected:%v actual:%v", msg, expected, actual)
+	}
+}
+
+// assertTreeValid checks the AVL balance, heights and subtree sizes of every node
+func assertTreeValid(t *testing.T, s OrderedSet) {
+	var check func(n *node) (int, int)
+	check = func(n *node) (int, int) {
+		if n == nil {
+			return 0, 0
+		}
+		lh, ls := check(n.left)
+		rh, rs := check(n.right)
+		if lh-rh > 1 || rh-lh > 1 {
+			t.Errorf("Node %s is unbalanced: %d vs %d", n.item.Key(), lh, rh)
+		}
+		if n.height != 1+max(lh, rh) || n.size != 1+ls+rs {
+			t.Errorf("Node %s has a stale height or size", n.item.Key())
+		}
+		return n.height, n.size
+	}
+	_, total := check(s.(*orderedSet).root)
+	if total != s.Size() {
+		t.Errorf("Tree has %d nodes but set has %d items", total, s.Size())
+	}
+}
+
+func TestOrderedSetAddRemove(t *testing.T) {
+	fmt.Println("TestOrderedSetAddRemove")
+	s := getPopulatedOrderedSet(5, 3, 8, 1, 4, 7, 9, 2, 6)
+	assertOperation(t, "add duplicate", s.Add(testItem{5}), false)
+	assertSetSize(t, s, 9)
+	assertIntsEqual(t, "ascending", []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, orderedKeys(s.Ascending()))
+	assertIntsEqual(t, "descending", []int{9, 8, 7, 6, 5, 4, 3, 2, 1}, orderedKeys(s.Descending()))
+
+	assertOperation(t, "remove 5", s.Remove(testItem{5}), true)
+	assertOperation(t, "remove 5 again", s.Remove(testItem{5}), false)
+	assertOperation(t, "contains 5", s.Contains(testItem{5}), false)
+	assertIntsEqual(t, "ascending after remove", []int{1, 2, 3, 4, 6, 7, 8, 9}, orderedKeys(s.All()))
+	assertTreeValid(t, s)
+
+	s.Empty()
+	assertSetSize(t, s, 0)
+	if _, found := s.Min(); found {
+		t.Errorf("Did not expect a minimum of an empty set")
+	}
+}
+
+func TestOrderedSetQueries(t *testing.T) {
+	fmt.Println("TestOrderedSetQueries")
+	s := getPopulatedOrderedSet(10, 20, 30, 40, 50)
+	var tests = []struct {
+		probe            int
+		floor, ceiling   int
+		hasFloor, hasCei bool
+		rank             int
+	}{
+		{5, 0, 10, false, true, 0},
+		{10, 10, 10, true, true, 0},
+		{25, 20, 30, true, true, 2},
+		{50, 50, 50, true, true, 4},
+		{55, 50, 0, true, false, 5},
+	}
+	for i, test := range tests {
+		probe := testItem{test.probe}
+		floor, found := s.Floor(probe)
+		if found != test.hasFloor || (found && floor.(testItem).i != test.floor) {
+			t.Errorf("Case %d failed, unexpected floor %v", i+1, floor)
+		}
+		ceiling, found := s.Ceiling(probe)
+		if found != test.hasCei || (found && ceiling.(testItem).i != test.ceiling) {
+			t.Errorf("Case %d failed, unexpected ceiling %v", i+1, ceiling)
+		}
+		if rank := s.Rank(probe); rank != test.rank {
+			t.Errorf("Case %d failed, expected rank %d, got %d", i+1, test.rank, rank)
+		}
+	}
+
+	min, _ := s.Min()
+	max, _ := s.Max()
+	assertIntsEqual(t, "min and max", []int{10, 50}, []int{min.(testItem).i, max.(testItem).i})
+	for k := 0; k < 5; k++ {
+		item, found := s.SelectKth(k)
+		if !found || item.(testItem).i != (k+1)*10 {
+			t.Errorf("Expected select %d to be %d, got %v", k, (k+1)*10, item)
+		}
+	}
+	if _, found := s.SelectKth(5); found {
+		t.Errorf("Did not expect to select past the end of the set")
+	}
+	assertIntsEqual(t, "range", []int{20, 30, 40}, orderedKeys(s.RangeBetween(testItem{15}, testItem{40})))
+	assertIntsEqual(t, "empty range", nil, orderedKeys(s.RangeBetween(testItem{41}, testItem{49})))
+}
+
+func TestOrderedSetRandom(t *testing.T) {
+	fmt.Println("TestOrderedSetRandom")
+	r := rand.New(rand.NewSource(1))
+	s := NewOrderedSet(testComparator)
+	reference := make(map[int]bool)
+	for i := 0; i < 5000; i++ {
+		v := r.Intn(1000)
+		if r.Intn(3) == 0 {
+			assertOperation(t, "remove matches reference", s.Remove(testItem{v}), reference[v])
+			delete(reference, v)
+			continue
+		}
+		assertOperation(t, "add matches reference", s.Add(testItem{v}), !reference[v])
+		reference[v] = true
+	}
+	assertTreeValid(t, s)
+
+	var expected []int
+	for v := range reference {
+		expected = append(expected, v)
+	}
+	sort.Ints(expected)
+	assertIntsEqual(t, "ascending matches sorted reference", expected, orderedKeys(s.Ascending()))
+	for k, v := range expected {
+		if rank := s.Rank(testItem{v}); rank != k {
+			t.Errorf("Expected rank of %d to be %d, got %d", v, k, rank)
+		}
+	}
+}
+
+func TestOrderedSetOperations(t *testing.T) {
+	fmt.Println("TestOrderedSetOperations")
+	s := getPopulatedOrderedSet(1, 2, 3, 4, 5, 6)
+	assertOperation(t, "equal to an unordered set", Equal(s, getPopulatedSet(1, 6)), true)
+	assertOperation(t, "union with adds 3", s.UnionWith(getPopulatedSet(5, 9)) == 3, true)
+	assertOperation(t, "difference with removes 2", s.DifferenceWith(getPopulatedSet(1, 2)) == 2, true)
+	assertOperation(t, "intersect with removes 2", s.IntersectWith(getPopulatedSet(3, 7)) == 2, true)
+	assertIntsEqual(t, "after in-place operations", []int{3, 4, 5, 6, 7}, orderedKeys(s.All()))
+	assertOperation(t, "remove odd items removes 3", s.RemoveIf(testPredicate) == 3, true)
+	assertIntsEqual(t, "after remove if", []int{4, 6}, orderedKeys(s.All()))
+	assertTreeValid(t, s)
+
+	u, _ := Union(s, getPopulatedSet(1, 2))
+	assertSetSize(t, u, 4)
+	assertIntsEqual(t, "limited select", []int{4}, orderedKeys(s.Select(PredicateAll, 1)))
+}
@@ -0,0 +1,273 @@
+package set
+
+import (
+	"hash/maphash"
+	"iter"
+	"math/bits"
+)
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+var hamtSeed = maphash.MakeSeed()
+
+func hashKey(key string) uint64 {
+	return maphash.String(hamtSeed, key)
+}
+
+// PersistentSet is an immutable set of Items stored in a hash array mapped trie.
+// Add and Remove return a new PersistentSet that shares every unchanged node with
+// the one it came from, so they only copy O(log n) nodes.
+//
+// Because a PersistentSet never changes it needs no locks, any number of
+// goroutines can read it while others derive new versions from it, and holding
+// on to a version is an O(1) snapshot. The zero value is an empty set.
+type PersistentSet struct {
+	root *hamtNode
+	size int
+}
+
+// hamtNode has an entry for every bit set in its bitmap, indexed by the
+// population count of the bits below it
+type hamtNode struct {
+	bitmap  uint32
+	entries []hamtEntry
+}
+
+// hamtEntry is either a child node or a leaf holding Items whose keys hash to
+// the same value. More than one Item in a leaf only happens on a full 64 bit
+// hash collision.
+type hamtEntry struct {
+	child *hamtNode
+	hash  uint64
+	items []Item
+}
+
+// NewPersistentSet returns a PersistentSet containing items
+func NewPersistentSet(items ...Item) *PersistentSet {
+	p := &PersistentSet{}
+	for _, item := range items {
+		p = p.Add(item)
+	}
+	return p
+}
+
+// PersistentFromSet returns a PersistentSet with the Items in a snapshot of s
+func PersistentFromSet(s Set) *PersistentSet {
+	return NewPersistentSet(s.Snapshot()...)
+}
+
+// ToSet returns a new Set with the same Items
+func (p *PersistentSet) ToSet() Set {
+	s := NewSet()
+	for item := range p.All() {
+		s.data()[item.Key()] = item
+	}
+	return s
+}
+
+// Size returns the number of Items
+func (p *PersistentSet) Size() int {
+	return p.size
+}
+
+// Get returns the Item with the same Key as item
+func (p *PersistentSet) Get(item Item) (Item, bool) {
+	key := item.Key()
+	hash := hashKey(key)
+	for n, shift := p.root, 0; n != nil; shift += hamtBits {
+		e, found := n.entry(hash, shift)
+		if !found {
+			return nil, false
+		}
+		if e.child != nil {
+			n = e.child
+			continue
+		}
+		if e.hash != hash {
+			return nil, false
+		}
+		for _, existing := range e.items {
+			if existing.Key() == key {
+				return existing, true
+			}
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// Contains is true if an Item with the same Key as item is in the set
+func (p *PersistentSet) Contains(item Item) bool {
+	_, found := p.Get(item)
+	return found
+}
+
+// Add returns a set that also contains item, or p itself if it already had an Item with that Key
+func (p *PersistentSet) Add(item Item) *PersistentSet {
+	return p.add(item, hashKey(item.Key()))
+}
+
+func (p *PersistentSet) add(item Item, hash uint64) *PersistentSet {
+	root, added := p.root.insert(item, hash, 0)
+	if !added {
+		return p
+	}
+	return &PersistentSet{root: root, size: p.size + 1}
+}
+
+// Remove returns a set without the Item with the same Key as item, or p itself if there wasn't one
+func (p *PersistentSet) Remove(item Item) *PersistentSet {
+	return p.remove(item.Key(), hashKey(item.Key()))
+}
+
+func (p *PersistentSet) remove(key string, hash uint64) *PersistentSet {
+	if p.root == nil {
+		return p
+	}
+	root, removed := p.root.remove(key, hash, 0)
+	if !removed {
+		return p
+	}
+	return &PersistentSet{root: root, size: p.size - 1}
+}
+
+// All iterates every Item, it's safe to use while other goroutines derive new sets from p
+func (p *PersistentSet) All() iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		p.root.iterate(yield)
+	}
+}
+
+func (n *hamtNode) position(hash uint64, shift int) (uint32, int) {
+	bit := uint32(1) << ((hash >> uint(shift)) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) entry(hash uint64, shift int) (hamtEntry, bool) {
+	bit, i := n.position(hash, shift)
+	if n.bitmap&bit == 0 {
+		return hamtEntry{}, false
+	}
+	return n.entries[i], true
+}
+
+// with returns a copy of n with the entry at i replaced
+func (n *hamtNode) with(i int, e hamtEntry) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries))
+	copy(entries, n.entries)
+	entries[i] = e
+	return &hamtNode{bitmap: n.bitmap, entries: entries}
+}
+
+// insert returns a copy of the path to item with it added, n may be nil
+func (n *hamtNode) insert(item Item, hash uint64, shift int) (*hamtNode, bool) {
+	leaf := hamtEntry{hash: hash, items: []Item{item}}
+	if n == nil {
+		return &hamtNode{bitmap: 1 << ((hash >> uint(shift)) & hamtMask), entries: []hamtEntry{leaf}}, true
+	}
+
+	bit, i := n.position(hash, shift)
+	if n.bitmap&bit == 0 {
+		entries := make([]hamtEntry, 0, len(n.entries)+1)
+		entries = append(append(append(entries, n.entries[:i]...), leaf), n.entries[i:]...)
+		return &hamtNode{bitmap: n.bitmap | bit, entries: entries}, true
+	}
+
+	e := n.entries[i]
+	if e.child != nil {
+		child, added := e.child.insert(item, hash, shift+hamtBits)
+		if !added {
+			return n, false
+		}
+		return n.with(i, hamtEntry{child: child}), true
+	}
+
+	if e.hash == hash {
+		for _, existing := range e.items {
+			if existing.Key() == item.Key() {
+				return n, false
+			}
+		}
+		items := append(append(make([]Item, 0, len(e.items)+1), e.items...), item)
+		return n.with(i, hamtEntry{hash: hash, items: items}), true
+	}
+
+	// two different hashes share this slot, push both down a level
+	child, _ := (&hamtNode{
+		bitmap:  1 << ((e.hash >> uint(shift+hamtBits)) & hamtMask),
+		entries: []hamtEntry{e},
+	}).insert(item, hash, shift+hamtBits)
+	return n.with(i, hamtEntry{child: child}), true
+}
+
+// remove returns a copy of the path to key with it removed, or nil if the node becomes empty
+func (n *hamtNode) remove(key string, hash uint64, shift int) (*hamtNode, bool) {
+	bit, i := n.position(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	e := n.entries[i]
+	if e.child != nil {
+		child, removed := e.child.remove(key, hash, shift+hamtBits)
+		if !removed {
+			return n, false
+		}
+		if child == nil {
+			return n.without(bit, i), true
+		}
+		if len(child.entries) == 1 && child.entries[0].child == nil {
+			// a lone leaf doesn't need a node of its own
+			return n.with(i, child.entries[0]), true
+		}
+		return n.with(i, hamtEntry{child: child}), true
+	}
+
+	if e.hash != hash {
+		return n, false
+	}
+	for j, existing := range e.items {
+		if existing.Key() != key {
+			continue
+		}
+		if len(e.items) == 1 {
+			return n.without(bit, i), true
+		}
+		items := append(append(make([]Item, 0, len(e.items)-1), e.items[:j]...), e.items[j+1:]...)
+		return n.with(i, hamtEntry{hash: hash, items: items}), true
+	}
+	return n, false
+}
+
+// without returns a copy of n without the entry at i, or nil if that was the last one
+func (n *hamtNode) without(bit uint32, i int) *hamtNode {
+	if len(n.entries) == 1 {
+		return nil
+	}
+	entries := make([]hamtEntry, 0, len(n.entries)-1)
+	entries = append(append(entries, n.entries[:i]...), n.entries[i+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, entries: entries}
+}
+
+func (n *hamtNode) iterate(yield func(Item) bool) bool {
+	if n == nil {
+		return true
+	}
+	for _, e := range n.entries {
+		if e.child != nil {
+			if !e.child.iterate(yield) {
+				return false
+			}
+			continue
+		}
+		for _, item := range e.items {
+			if !yield(item) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package set
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func persistentKeys(p *PersistentSet) []string {
+	var keys []string
+	for item := range p.All() {
+		keys = append(keys, item.Key())
+	}
+	return keys
+}
+
+func TestPersistentAddRemove(t *testing.T) {
+	fmt.Println("TestPersistentAddRemove")
+	var empty PersistentSet
+	p1 := empty.Add(testItem{1})
+	p2 := p1.Add(testItem{2})
+	assertOperation(t, "adding an existing item returns the same set", p2.Add(testItem{2}) == p2, true)
+	p3 := p2.Remove(testItem{1})
+	assertOperation(t, "removing a missing item returns the same set", p3.Remove(testItem{1}) == p3, true)
+
+	// every version is unaffected by the ones derived from it
+	var tests = []struct {
+		p        *PersistentSet
+		expected []string
+	}{
+		{&empty, []string{}},
+		{p1, []string{"1"}},
+		{p2, []string{"1", "2"}},
+		{p3, []string{"2"}},
+	}
+	for i, test := range tests {
+		if test.p.Size() != len(test.expected) {
+			t.Errorf("Case %d failed, expected size %d, got %d", i+1, len(test.expected), test.p.Size())
+		}
+		assertKeyArrayEquals(t, test.expected, persistentKeys(test.p))
+	}
+
+	item, found := p2.Get(testItem{2})
+	if !found || item.Key() != "2" {
+		t.Errorf("Expected to get item 2 back")
+	}
+	assertOperation(t, "contains removed item", p3.Contains(testItem{1}), false)
+}
+
+func TestPersistentRandom(t *testing.T) {
+	fmt.Println("TestPersistentRandom")
+	r := rand.New(rand.NewSource(1))
+	p := NewPersistentSet()
+	reference := make(map[int]bool)
+	for i := 0; i < 20000; i++ {
+		v := r.Intn(5000)
+		if r.Intn(3) == 0 {
+			next := p.Remove(testItem{v})
+			assertOperation(t, "remove matches reference", next != p, reference[v])
+			delete(reference, v)
+			p = next
+			continue
+		}
+		next := p.Add(testItem{v})
+		assertOperation(t, "add matches reference", next != p, !reference[v])
+		reference[v] = true
+		p = next
+	}
+	if p.Size() != len(reference) {
+		t.Errorf("Expected size %d, got %d", len(reference), p.Size())
+	}
+	for v := 0; v < 5000; v++ {
+		if p.Contains(testItem{v}) != reference[v] {
+			t.Errorf("Expected contains %d to be %t", v, reference[v])
+		}
+	}
+	if len(persistentKeys(p)) != len(reference) {
+		t.Errorf("Expected to iterate %d items", len(reference))
+	}
+}
+
+// TestPersistentCollisions forces items to share a hash, or most of one
+func TestPersistentCollisions(t *testing.T) {
+	fmt.Println("TestPersistentCollisions")
+	p := NewPersistentSet()
+	hashes := []uint64{42, 42, 42 | 1<<60, 42 | 1<<40}
+	for i, hash := range hashes {
+		p = p.add(testItem{i}, hash)
+	}
+	assertKeyArrayEquals(t, []string{"0", "1", "2", "3"}, persistentKeys(p))
+	assertOperation(t, "duplicate in a collision is not added", p.add(testItem{1}, 42) == p, true)
+
+	for i, hash := range hashes {
+		p = p.remove(testItem{i}.Key(), hash)
+		if p.Size() != len(hashes)-i-1 {
+			t.Errorf("Expected size %d after removing %d, got %d", len(hashes)-i-1, i, p.Size())
+		}
+	}
+	assertOperation(t, "empty after removing everything", p.root == nil, true)
+}
+
+func TestPersistentConversion(t *testing.T) {
+	fmt.Println("TestPersistentConversion")
+	s := getPopulatedSet(1, 10)
+	p := PersistentFromSet(s)
+	s.Empty()
+	assertOperation(t, "persistent set is unaffected by the source", p.Size() == 10, true)
+	assertOperation(t, "round trip equals the source", Equal(p.ToSet(), getPopulatedSet(1, 10)), true)
+}
+
+func TestPersistentConcurrentReaders(t *testing.T) {
+	fmt.Println("TestPersistentConcurrentReaders")
+	p := NewPersistentSet()
+	for i := 0; i < 100; i++ {
+		p = p.Add(testItem{i})
+	}
+	var wg sync.WaitGroup
+	wg.Add(stressWorkers)
+	for w := 0; w < stressWorkers; w++ {
+		go func(worker int) {
+			defer wg.Done()
+			derived := p
+			for i := 0; i < stressIterations; i++ {
+				derived = derived.Add(testItem{1000*worker + i}).Remove(testItem{i % 100})
+				for range p.All() {
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	assertOperation(t, "the shared version never changes", p.Size() == 100 && len(persistentKeys(p)) == 100, true)
+}
@@ -0,0 +1,301 @@
+package set
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// digestHashes is the number of cells each key is added to
+	digestHashes = 3
+	// reconcileAttempts is how many times Reconcile doubles the digest size before giving up
+	reconcileAttempts = 5
+)
+
+var (
+	// ErrDigestUndecodable when a digest is too small for the difference between two sets
+	ErrDigestUndecodable = errors.New("digest is too small to decode the difference between the sets")
+	// ErrDigestMismatch when subtracting digests with a different number of cells
+	ErrDigestMismatch = errors.New("cannot subtract digests of different sizes")
+)
+
+// Digest is an invertible Bloom lookup table over the hashes of a set's Keys.
+// Subtracting the digest of one set from another's leaves only the Keys that
+// aren't in both, and as long as there are fewer of those than roughly 4/5 of
+// the cells they can be recovered. The size of a digest depends on the size of
+// the difference it can recover, not on the size of the sets.
+type Digest struct {
+	cells []digestCell
+}
+
+type digestCell struct {
+	count   int64
+	keySum  uint64
+	hashSum uint64
+}
+
+// NewDigest returns a digest of a snapshot of s with the given number of cells,
+// which is rounded up to a multiple of 3
+func NewDigest(s Set, cells int) *Digest {
+	d := newDigest(cells)
+	for _, item := range s.Snapshot() {
+		d.update(keyHash(item.Key()), 1)
+	}
+	return d
+}
+
+func newDigest(cells int) *Digest {
+	cells = max(cells, digestHashes)
+	cells += (digestHashes - cells%digestHashes) % digestHashes
+	return &Digest{cells: make([]digestCell, cells)}
+}
+
+// keyHash is the 64 bit identity of an Item in a digest
+func keyHash(key string) uint64 {
+	return splitmix64(fnv64a(key))
+}
+
+func checksum(h uint64) uint64 {
+	return splitmix64(h ^ 0x5851F42D4C957F2D)
+}
+
+// update adds count occurrences of h, each of the digestHashes cells it lands
+// in is in a different third of the table so they never coincide
+func (d *Digest) update(h uint64, count int64) {
+	part := uint64(len(d.cells) / digestHashes)
+	sum := checksum(h)
+	for i := uint64(0); i < digestHashes; i++ {
+		c := &d.cells[i*part+splitmix64(h+i*0x9E3779B97F4A7C15)%part]
+		c.count += count
+		c.keySum ^= h
+		c.hashSum ^= sum
+	}
+}
+
+// Size returns the number of cells
+func (d *Digest) Size() int {
+	return len(d.cells)
+}
+
+// Subtract returns d - other, in which Keys only in d have a count of 1 and Keys only in other a count of -1
+func (d *Digest) Subtract(other *Digest) (*Digest, error) {
+	if len(d.cells) != len(other.cells) {
+		return nil, ErrDigestMismatch
+	}
+
+	result := &Digest{cells: make([]digestCell, len(d.cells))}
+	for i, c := range d.cells {
+		o := other.cells[i]
+		result.cells[i] = digestCell{
+			count:   c.count - o.count,
+			keySum:  c.keySum ^ o.keySum,
+			hashSum: c.hashSum ^ o.hashSum,
+		}
+	}
+	return result, nil
+}
+
+// Decode recovers the Key hashes of a subtracted digest, positive are the ones
+// only in the digest subtracted from and negative the ones only in the other
+func (d *Digest) Decode() (positive, negative []uint64, err error) {
+	cells := append([]digestCell(nil), d.cells...)
+	peeled := &Digest{cells: cells}
+
+	pure := func(c digestCell) bool {
+		return (c.count == 1 || c.count == -1) && c.hashSum == checksum(c.keySum)
+	}
+	var queue []int
+	for i, c := range cells {
+		if pure(c) {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		c := cells[i]
+		if !pure(c) {
+			continue
+		}
+
+		if c.count == 1 {
+			positive = append(positive, c.keySum)
+		} else {
+			negative = append(negative, c.keySum)
+		}
+		peeled.update(c.keySum, -c.count)
+
+		part := len(cells) / digestHashes
+		for j := 0; j < digestHashes; j++ {
+			k := j*part + int(splitmix64(c.keySum+uint64(j)*0x9E3779B97F4A7C15)%uint64(part))
+			if pure(cells[k]) {
+				queue = append(queue, k)
+			}
+		}
+	}
+
+	for _, c := range cells {
+		if c != (digestCell{}) {
+			return nil, nil, ErrDigestUndecodable
+		}
+	}
+	return positive, negative, nil
+}
+
+// MarshalBinary encodes the digest as a version byte, the number of cells as a
+// uvarint and then each cell's count as a varint followed by its two sums
+func (d *Digest) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint([]byte{binaryVersion}, uint64(len(d.cells)))
+	for _, c := range d.cells {
+		buf = binary.AppendVarint(buf, c.count)
+		buf = binary.LittleEndian.AppendUint64(buf, c.keySum)
+		buf = binary.LittleEndian.AppendUint64(buf, c.hashSum)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the digest with one written by MarshalBinary
+func (d *Digest) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return ErrInvalidEncoding
+	}
+	if data[0] != binaryVersion {
+		return ErrUnsupportedVersion
+	}
+	data = data[1:]
+
+	n, read := binary.Uvarint(data)
+	if read <= 0 || n%digestHashes != 0 || n > uint64(len(data)) {
+		return ErrInvalidEncoding
+	}
+	data = data[read:]
+
+	cells := make([]digestCell, n)
+	for i := range cells {
+		count, read := binary.Varint(data)
+		if read <= 0 || len(data) < read+16 {
+			return ErrInvalidEncoding
+		}
+		cells[i] = digestCell{
+			count:   count,
+			keySum:  binary.LittleEndian.Uint64(data[read:]),
+			hashSum: binary.LittleEndian.Uint64(data[read+8:]),
+		}
+		data = data[read+16:]
+	}
+	if len(data) != 0 {
+		return ErrInvalidEncoding
+	}
+
+	d.cells = cells
+	return nil
+}
+
+// Peer is the remote side of a reconciliation
+type Peer interface {
+	// Digest returns a digest of the remote set with the given number of cells
+	Digest(cells int) (*Digest, error)
+	// Fetch returns the remote Items whose Key hashes are in hashes
+	Fetch(hashes []uint64) ([]Item, error)
+}
+
+// Reconciliation is the symmetric difference between a local and a remote set
+type Reconciliation struct {
+	LocalOnly  []Item
+	RemoteOnly []Item
+}
+
+// Reconcile finds the Items that are only in local or only in remote by
+// exchanging digests instead of the sets. cells should be about 1.5 times the
+// expected size of the difference, if the digest turns out to be too small it's
+// doubled and tried again a few times before ErrDigestUndecodable is returned.
+// It's raised to the smallest digest if it's less than that. Only the Items
+// that differ are fetched from the remote.
+func Reconcile(local Set, remote Peer, cells int) (Reconciliation, error) {
+	cells = max(cells, digestHashes)
+	items := local.Snapshot()
+	for attempt := 0; attempt < reconcileAttempts; attempt, cells = attempt+1, cells*2 {
+		remoteDigest, err := remote.Digest(cells)
+		if err != nil {
+			return Reconciliation{}, err
+		}
+		localDigest := newDigest(cells)
+		for _, item := range items {
+			localDigest.update(keyHash(item.Key()), 1)
+		}
+		diff, err := localDigest.Subtract(remoteDigest)
+		if err != nil {
+			return Reconciliation{}, err
+		}
+
+		localHashes, remoteHashes, err := diff.Decode()
+		if err == ErrDigestUndecodable {
+			continue
+		}
+		if err != nil {
+			return Reconciliation{}, err
+		}
+
+		var result Reconciliation
+		wanted := make(map[uint64]bool, len(localHashes))
+		for _, h := range localHashes {
+			wanted[h] = true
+		}
+		for _, item := range items {
+			if wanted[keyHash(item.Key())] {
+				result.LocalOnly = append(result.LocalOnly, item)
+			}
+		}
+		if len(remoteHashes) > 0 {
+			if result.RemoteOnly, err = remote.Fetch(remoteHashes); err != nil {
+				return Reconciliation{}, err
+			}
+		}
+		return result, nil
+	}
+	return Reconciliation{}, ErrDigestUndecodable
+}
+
+// NewInProcessPeer returns a Peer serving s from the same process. Digests and
+// Items are passed through their binary encodings, with codec for the Items, so
+// it behaves like a Peer over a network would.
+func NewInProcessPeer(s Set, codec ItemCodec) Peer {
+	return &inProcessPeer{s: s, codec: codec}
+}
+
+type inProcessPeer struct {
+	s     Set
+	codec ItemCodec
+}
+
+func (p *inProcessPeer) Digest(cells int) (*Digest, error) {
+	data, err := NewDigest(p.s, cells).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	d := &Digest{}
+	return d, d.UnmarshalBinary(data)
+}
+
+func (p *inProcessPeer) Fetch(hashes []uint64) ([]Item, error) {
+	wanted := make(map[uint64]bool, len(hashes))
+	for _, h := range hashes {
+		wanted[h] = true
+	}
+	found := NewSet()
+	for _, item := range p.s.Snapshot() {
+		if wanted[keyHash(item.Key())] {
+			found.Add(item)
+		}
+	}
+
+	data, err := EncodeBinary(found, p.codec)
+	if err != nil {
+		return nil, err
+	}
+	received := NewSet()
+	if err := DecodeBinary(data, received, p.codec); err != nil {
+		return nil, err
+	}
+	return received.Snapshot(), nil
+}
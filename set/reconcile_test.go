@@ -0,0 +1,154 @@
+package set
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDigestDecode(t *testing.T) {
+	fmt.Println("TestDigestDecode")
+	d1, d2 := NewDigest(getPopulatedSet(1, 1000), 30), NewDigest(getPopulatedSet(6, 1003), 30)
+	diff, err := d1.Subtract(d2)
+	if err != nil {
+		t.Error(err)
+	}
+	positive, negative, err := diff.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(start, end int) map[uint64]bool {
+		m := make(map[uint64]bool)
+		for i := start; i <= end; i++ {
+			m[keyHash(testItem{i}.Key())] = true
+		}
+		return m
+	}
+	for name, test := range map[string]struct {
+		actual   []uint64
+		expected map[uint64]bool
+	}{
+		"positive": {positive, expect(1, 5)},
+		"negative": {negative, expect(1001, 1003)},
+	} {
+		if len(test.actual) != len(test.expected) {
+			t.Errorf("Expected %d %s hashes, got %d", len(test.expected), name, len(test.actual))
+		}
+		for _, h := range test.actual {
+			if !test.expected[h] {
+				t.Errorf("Unexpected %s hash %d", name, h)
+			}
+		}
+	}
+}
+
+func TestDigestTooSmall(t *testing.T) {
+	fmt.Println("TestDigestTooSmall")
+	diff, _ := NewDigest(getPopulatedSet(1, 100), 6).Subtract(NewDigest(getPopulatedSet(1, 0), 6))
+	if _, _, err := diff.Decode(); err != ErrDigestUndecodable {
+		t.Errorf("Expected error %s, got [%v] instead", ErrDigestUndecodable, err)
+	}
+	if _, err := NewDigest(getPopulatedSet(1, 1), 6).Subtract(NewDigest(getPopulatedSet(1, 1), 9)); err != ErrDigestMismatch {
+		t.Errorf("Expected error %s, got [%v] instead", ErrDigestMismatch, err)
+	}
+}
+
+func TestDigestEncoding(t *testing.T) {
+	fmt.Println("TestDigestEncoding")
+	d := NewDigest(getPopulatedSet(1, 50), 12)
+	data, _ := d.MarshalBinary()
+	decoded := &Digest{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Error(err)
+	}
+	diff, _ := d.Subtract(decoded)
+	if positive, negative, err := diff.Decode(); err != nil || len(positive)+len(negative) != 0 {
+		t.Errorf("Expected a decoded digest to equal the original")
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err != ErrInvalidEncoding {
+		t.Errorf("Expected error %s, got [%v] instead", ErrInvalidEncoding, err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	fmt.Println("TestReconcile")
+	var tests = []struct {
+		local, remote         Set
+		localOnly, remoteOnly []int
+		cells                 int
+	}{
+		{getPopulatedSet(1, 1000), getPopulatedSet(1, 1000), nil, nil, 10},
+		{getPopulatedSet(1, 1000), getPopulatedSet(11, 1010), []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1001, 1002, 1003, 1004, 1005, 1006, 1007, 1008, 1009, 1010}, 30},
+		// the initial digest is far too small, it has to grow
+		{getPopulatedSet(1, 100), getPopulatedSet(51, 150), nil, nil, 20},
+		{getPopulatedSet(1, 0), getPopulatedSet(1, 5), nil, []int{1, 2, 3, 4, 5}, 9},
+	}
+	for i, test := range tests {
+		result, err := Reconcile(test.local, NewInProcessPeer(test.remote, testKeyCodec), test.cells)
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+			continue
+		}
+		expectedLocal, _ := Difference(test.local, test.remote)
+		expectedRemote, _ := Difference(test.remote, test.local)
+		assertOperation(t, fmt.Sprintf("case %d local only", i+1), Equal(expectedLocal, setOf(result.LocalOnly)), true)
+		assertOperation(t, fmt.Sprintf("case %d remote only", i+1), Equal(expectedRemote, setOf(result.RemoteOnly)), true)
+		if test.localOnly != nil {
+			assertSetContainsItems(t, setOf(result.LocalOnly), test.localOnly)
+		}
+		if test.remoteOnly != nil {
+			assertSetContainsItems(t, setOf(result.RemoteOnly), test.remoteOnly)
+		}
+
+		// applying the difference brings both sides in sync
+		test.local.UnionWith(setOf(result.RemoteOnly))
+		test.remote.UnionWith(setOf(result.LocalOnly))
+		assertOperation(t, fmt.Sprintf("case %d in sync", i+1), Equal(test.local, test.remote), true)
+	}
+}
+
+// sizingPeer records the digest sizes it's asked for
+type sizingPeer struct {
+	Peer
+	sizes []int
+}
+
+func (p *sizingPeer) Digest(cells int) (*Digest, error) {
+	p.sizes = append(p.sizes, cells)
+	return p.Peer.Digest(cells)
+}
+
+func TestReconcileNoCells(t *testing.T) {
+	fmt.Println("TestReconcileNoCells")
+	for _, cells := range []int{0, -5} {
+		remote := &sizingPeer{Peer: NewInProcessPeer(getPopulatedSet(1, 20), testKeyCodec)}
+		result, err := Reconcile(getPopulatedSet(1, 10), remote, cells)
+		if err != nil {
+			t.Fatalf("Unexpected error with %d cells: %s", cells, err)
+		}
+		assertSetContainsItems(t, setOf(result.RemoteOnly), []int{11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+		if len(remote.sizes) < 2 || remote.sizes[0] != digestHashes {
+			t.Fatalf("Expected the digest to start at %d cells and grow, got sizes %v", digestHashes, remote.sizes)
+		}
+		for i := 1; i < len(remote.sizes); i++ {
+			if remote.sizes[i] != 2*remote.sizes[i-1] {
+				t.Errorf("Expected the digest to double each attempt, got sizes %v", remote.sizes)
+			}
+		}
+	}
+}
+
+func TestReconcileGivesUp(t *testing.T) {
+	fmt.Println("TestReconcileGivesUp")
+	_, err := Reconcile(getPopulatedSet(1, 5000), NewInProcessPeer(getPopulatedSet(1, 0), testKeyCodec), 3)
+	if err != ErrDigestUndecodable {
+		t.Errorf("Expected error %s, got [%v] instead", ErrDigestUndecodable, err)
+	}
+}
+
+func setOf(items []Item) Set {
+	s := NewSet()
+	for _, item := range items {
+		s.Add(item)
+	}
+	return s
+}
@@ -0,0 +1,342 @@
+package set
+
+import (
+	"iter"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Roaring is a compressed bitmap of uint32 members. Members are split into
+// chunks by their high 16 bits, and each chunk is stored in whichever container
+// is smallest for it: a sorted array when it's sparse, a bitmap when it's dense,
+// or a list of runs after RunOptimize when it's made of long consecutive ranges.
+//
+// Like Set it's safe for concurrent use, operations on two Roaring bitmaps read
+// lock both in a global order so they can't deadlock each other.
+type Roaring struct {
+	mutex      sync.RWMutex
+	keys       []uint16
+	containers []container
+	seq        uint64
+}
+
+// NewRoaring returns an empty Roaring bitmap
+func NewRoaring() *Roaring {
+	return &Roaring{seq: atomic.AddUint64(&sequence, 1)}
+}
+
+// NewRoaringOf returns a Roaring bitmap containing values
+func NewRoaringOf(values ...uint32) *Roaring {
+	r := NewRoaring()
+	for _, v := range values {
+		r.add(v)
+	}
+	return r
+}
+
+func (r *Roaring) lock(write bool) {
+	if write {
+		r.mutex.Lock()
+		return
+	}
+
+	r.mutex.RLock()
+}
+
+func (r *Roaring) unlock(write bool) {
+	if write {
+		r.mutex.Unlock()
+		return
+	}
+
+	r.mutex.RUnlock()
+}
+
+// rlockBoth read locks r and other in ascending sequence and returns the function releasing them
+func (r *Roaring) rlockBoth(other *Roaring) func() {
+	if r == other {
+		r.lock(false)
+		return func() { r.unlock(false) }
+	}
+
+	first, second := r, other
+	if other.seq < r.seq {
+		first, second = other, r
+	}
+	first.lock(false)
+	second.lock(false)
+	return func() {
+		second.unlock(false)
+		first.unlock(false)
+	}
+}
+
+func split(v uint32) (uint16, uint16) {
+	return uint16(v >> 16), uint16(v)
+}
+
+// find returns the index of the container for key, or where it would be inserted
+func (r *Roaring) find(key uint16) (int, bool) {
+	i := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= key })
+	return i, i < len(r.keys) && r.keys[i] == key
+}
+
+func (r *Roaring) add(v uint32) bool {
+	hi, lo := split(v)
+	i, found := r.find(hi)
+	if !found {
+		r.keys = append(r.keys, 0)
+		copy(r.keys[i+1:], r.keys[i:])
+		r.keys[i] = hi
+		r.containers = append(r.containers, nil)
+		copy(r.containers[i+1:], r.containers[i:])
+		r.containers[i] = &arrayContainer{values: []uint16{lo}}
+		return true
+	}
+
+	c, added := r.containers[i].add(lo)
+	r.containers[i] = c
+	return added
+}
+
+// Add puts v in the bitmap, returning false if it was already there
+func (r *Roaring) Add(v uint32) bool {
+	r.lock(true)
+	defer r.unlock(true)
+
+	return r.add(v)
+}
+
+// Remove takes v out of the bitmap, returning false if it wasn't there
+func (r *Roaring) Remove(v uint32) bool {
+	r.lock(true)
+	defer r.unlock(true)
+
+	hi, lo := split(v)
+	i, found := r.find(hi)
+	if !found {
+		return false
+	}
+
+	c, removed := r.containers[i].remove(lo)
+	if c.cardinality() == 0 {
+		r.keys = append(r.keys[:i], r.keys[i+1:]...)
+		r.containers = append(r.containers[:i], r.containers[i+1:]...)
+		return removed
+	}
+	r.containers[i] = c
+	return removed
+}
+
+// Contains is true if v is in the bitmap
+func (r *Roaring) Contains(v uint32) bool {
+	r.lock(false)
+	defer r.unlock(false)
+
+	hi, lo := split(v)
+	i, found := r.find(hi)
+	return found && r.containers[i].contains(lo)
+}
+
+// Empty removes every member
+func (r *Roaring) Empty() {
+	r.lock(true)
+	defer r.unlock(true)
+
+	r.keys = nil
+	r.containers = nil
+}
+
+// Cardinality returns the number of members
+func (r *Roaring) Cardinality() uint64 {
+	r.lock(false)
+	defer r.unlock(false)
+
+	return r.cardinality()
+}
+
+func (r *Roaring) cardinality() uint64 {
+	var card uint64
+	for _, c := range r.containers {
+		card += uint64(c.cardinality())
+	}
+	return card
+}
+
+// Rank returns the number of members less than or equal to v
+func (r *Roaring) Rank(v uint32) uint64 {
+	r.lock(false)
+	defer r.unlock(false)
+
+	hi, lo := split(v)
+	var rank uint64
+	for i, key := range r.keys {
+		if key > hi {
+			break
+		}
+		if key < hi {
+			rank += uint64(r.containers[i].cardinality())
+			continue
+		}
+		rank += uint64(r.containers[i].rank(lo))
+	}
+	return rank
+}
+
+// Select returns the ith smallest member counting from 0
+func (r *Roaring) Select(i uint64) (uint32, bool) {
+	r.lock(false)
+	defer r.unlock(false)
+
+	for k, c := range r.containers {
+		card := uint64(c.cardinality())
+		if i >= card {
+			i -= card
+			continue
+		}
+		return uint32(r.keys[k])<<16 | uint32(c.selectAt(int(i))), true
+	}
+	return 0, false
+}
+
+// RunOptimize converts every container to its smallest representation, which
+// is usually worth doing once a bitmap has been bulk loaded
+func (r *Roaring) RunOptimize() {
+	r.lock(true)
+	defer r.unlock(true)
+
+	for i, c := range r.containers {
+		r.containers[i] = runOptimize(c)
+	}
+}
+
+// clone deep copies the bitmap, callers must hold the read lock
+func (r *Roaring) clone() *Roaring {
+	c := NewRoaring()
+	c.keys = append([]uint16(nil), r.keys...)
+	c.containers = make([]container, len(r.containers))
+	for i, container := range r.containers {
+		c.containers[i] = container.clone()
+	}
+	return c
+}
+
+// All iterates the members in ascending order over a snapshot of the bitmap
+func (r *Roaring) All() iter.Seq[uint32] {
+	return func(yield func(uint32) bool) {
+		r.lock(false)
+		snapshot := r.clone()
+		r.unlock(false)
+
+		for i, c := range snapshot.containers {
+			hi := uint32(snapshot.keys[i]) << 16
+			if !c.iterate(func(lo uint16) bool { return yield(hi | uint32(lo)) }) {
+				return
+			}
+		}
+	}
+}
+
+// Union returns a new bitmap with the members of both r and other
+func (r *Roaring) Union(other *Roaring) *Roaring {
+	defer r.rlockBoth(other)()
+
+	result := NewRoaring()
+	i, j := 0, 0
+	for i < len(r.keys) || j < len(other.keys) {
+		switch {
+		case j == len(other.keys) || (i < len(r.keys) && r.keys[i] < other.keys[j]):
+			result.append(r.keys[i], r.containers[i].clone())
+			i++
+		case i == len(r.keys) || other.keys[j] < r.keys[i]:
+			result.append(other.keys[j], other.containers[j].clone())
+			j++
+		default:
+			result.append(r.keys[i], unionContainers(r.containers[i], other.containers[j]))
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Intersection returns a new bitmap with the members common to r and other
+func (r *Roaring) Intersection(other *Roaring) *Roaring {
+	defer r.rlockBoth(other)()
+
+	result := NewRoaring()
+	for i, key := range r.keys {
+		if j, found := other.find(key); found {
+			result.append(key, intersectContainers(r.containers[i], other.containers[j]))
+		}
+	}
+	return result
+}
+
+// Difference returns a new bitmap with the members of r that aren't in other
+func (r *Roaring) Difference(other *Roaring) *Roaring {
+	defer r.rlockBoth(other)()
+
+	result := NewRoaring()
+	for i, key := range r.keys {
+		if j, found := other.find(key); found {
+			result.append(key, differenceContainers(r.containers[i], other.containers[j]))
+			continue
+		}
+		result.append(key, r.containers[i].clone())
+	}
+	return result
+}
+
+// append adds a container for a key larger than any already present, nil containers are skipped
+func (r *Roaring) append(key uint16, c container) {
+	if c == nil {
+		return
+	}
+	r.keys = append(r.keys, key)
+	r.containers = append(r.containers, c)
+}
+
+// Equal returns true if r and other have the same members
+func (r *Roaring) Equal(other *Roaring) bool {
+	defer r.rlockBoth(other)()
+
+	if len(r.keys) != len(other.keys) {
+		return false
+	}
+	for i, key := range r.keys {
+		if other.keys[i] != key || r.containers[i].cardinality() != other.containers[i].cardinality() {
+			return false
+		}
+		if !containsContainer(r.containers[i], other.containers[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Subset determines if other is a subset of r
+func (r *Roaring) Subset(other *Roaring) bool {
+	defer r.rlockBoth(other)()
+
+	return containsRoaring(r, other)
+}
+
+// Superset determines if other is a super set of r
+func (r *Roaring) Superset(other *Roaring) bool {
+	defer r.rlockBoth(other)()
+
+	return containsRoaring(other, r)
+}
+
+// containsRoaring is true if every member of inner is in outer
+func containsRoaring(outer, inner *Roaring) bool {
+	for i, key := range inner.keys {
+		j, found := outer.find(key)
+		if !found || !containsContainer(outer.containers[j], inner.containers[i]) {
+			return false
+		}
+	}
+	return true
+}
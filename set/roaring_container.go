@@ -0,0 +1,460 @@
+package set
+
+import (
+	"math/bits"
+	"sort"
+)
+
+const (
+	// maxArraySize is the largest cardinality kept in an arrayContainer, past
+	// it a bitmapContainer is smaller
+	maxArraySize = 4096
+	bitmapWords  = 1024
+)
+
+// container holds the low 16 bits of the members of a Roaring bitmap that share
+// the same high 16 bits. Mutations may return a different kind of container
+// when another representation fits the new cardinality better.
+type container interface {
+	contains(v uint16) bool
+	add(v uint16) (container, bool)
+	remove(v uint16) (container, bool)
+	cardinality() int
+	// rank returns the number of members less than or equal to v
+	rank(v uint16) int
+	// selectAt returns the ith smallest member
+	selectAt(i int) uint16
+	// iterate calls fn on the members in ascending order until it returns false
+	iterate(fn func(uint16) bool) bool
+	numRuns() int
+	clone() container
+}
+
+// arrayContainer is a sorted array of members, used for sparse containers
+type arrayContainer struct {
+	values []uint16
+}
+
+func (a *arrayContainer) search(v uint16) int {
+	return sort.Search(len(a.values), func(i int) bool { return a.values[i] >= v })
+}
+
+func (a *arrayContainer) contains(v uint16) bool {
+	i := a.search(v)
+	return i < len(a.values) && a.values[i] == v
+}
+
+func (a *arrayContainer) add(v uint16) (container, bool) {
+	i := a.search(v)
+	if i < len(a.values) && a.values[i] == v {
+		return a, false
+	}
+	if len(a.values) == maxArraySize {
+		b := toBitmap(a)
+		b.add(v)
+		return b, true
+	}
+	a.values = append(a.values, 0)
+	copy(a.values[i+1:], a.values[i:])
+	a.values[i] = v
+	return a, true
+}
+
+func (a *arrayContainer) remove(v uint16) (container, bool) {
+	i := a.search(v)
+	if i == len(a.values) || a.values[i] != v {
+		return a, false
+	}
+	a.values = append(a.values[:i], a.values[i+1:]...)
+	return a, true
+}
+
+func (a *arrayContainer) cardinality() int {
+	return len(a.values)
+}
+
+func (a *arrayContainer) rank(v uint16) int {
+	return sort.Search(len(a.values), func(i int) bool { return a.values[i] > v })
+}
+
+func (a *arrayContainer) selectAt(i int) uint16 {
+	return a.values[i]
+}
+
+func (a *arrayContainer) iterate(fn func(uint16) bool) bool {
+	for _, v := range a.values {
+		if !fn(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *arrayContainer) numRuns() int {
+	runs := 0
+	for i, v := range a.values {
+		if i == 0 || a.values[i-1]+1 != v {
+			runs++
+		}
+	}
+	return runs
+}
+
+func (a *arrayContainer) clone() container {
+	return &arrayContainer{values: append([]uint16(nil), a.values...)}
+}
+
+// bitmapContainer is one bit per possible member, used for dense containers
+type bitmapContainer struct {
+	words [bitmapWords]uint64
+	card  int
+}
+
+func (b *bitmapContainer) contains(v uint16) bool {
+	return b.words[v>>6]&(1<<(v&63)) != 0
+}
+
+func (b *bitmapContainer) add(v uint16) (container, bool) {
+	if b.contains(v) {
+		return b, false
+	}
+	b.words[v>>6] |= 1 << (v & 63)
+	b.card++
+	return b, true
+}
+
+func (b *bitmapContainer) remove(v uint16) (container, bool) {
+	if !b.contains(v) {
+		return b, false
+	}
+	b.words[v>>6] &^= 1 << (v & 63)
+	b.card--
+	if b.card <= maxArraySize {
+		return toArray(b), true
+	}
+	return b, true
+}
+
+func (b *bitmapContainer) cardinality() int {
+	return b.card
+}
+
+func (b *bitmapContainer) rank(v uint16) int {
+	rank := 0
+	for _, w := range b.words[:v>>6] {
+		rank += bits.OnesCount64(w)
+	}
+	return rank + bits.OnesCount64(b.words[v>>6]<<(63-v&63))
+}
+
+func (b *bitmapContainer) selectAt(i int) uint16 {
+	for w, word := range b.words {
+		count := bits.OnesCount64(word)
+		if i >= count {
+			i -= count
+			continue
+		}
+		for ; i > 0; i-- {
+			word &= word - 1
+		}
+		return uint16(w<<6 | bits.TrailingZeros64(word))
+	}
+	panic("set: select past the end of a bitmap container")
+}
+
+func (b *bitmapContainer) iterate(fn func(uint16) bool) bool {
+	for w, word := range b.words {
+		for word != 0 {
+			if !fn(uint16(w<<6 | bits.TrailingZeros64(word))) {
+				return false
+			}
+			word &= word - 1
+		}
+	}
+	return true
+}
+
+func (b *bitmapContainer) numRuns() int {
+	runs := 0
+	var carry uint64
+	for _, w := range b.words {
+		// a run starts at every set bit whose lower neighbour isn't set
+		runs += bits.OnesCount64(w &^ (w<<1 | carry))
+		carry = w >> 63
+	}
+	return runs
+}
+
+func (b *bitmapContainer) clone() container {
+	c := *b
+	return &c
+}
+
+// recount recalculates the cardinality after words have been modified directly
+func (b *bitmapContainer) recount() {
+	b.card = 0
+	for _, w := range b.words {
+		b.card += bits.OnesCount64(w)
+	}
+}
+
+// interval is a run of consecutive members, length is the number of members minus one
+type interval struct {
+	start, length uint16
+}
+
+func (i interval) end() int {
+	return int(i.start) + int(i.length)
+}
+
+// runContainer is a sorted list of runs, used for containers of long consecutive
+// ranges. It's only produced by RunOptimize and unmarshalling, mutations turn it
+// back into an array or bitmap.
+type runContainer struct {
+	runs []interval
+}
+
+func (r *runContainer) contains(v uint16) bool {
+	i := sort.Search(len(r.runs), func(i int) bool { return r.runs[i].end() >= int(v) })
+	return i < len(r.runs) && r.runs[i].start <= v
+}
+
+func (r *runContainer) add(v uint16) (container, bool) {
+	if r.contains(v) {
+		return r, false
+	}
+	c, _ := toNonRun(r).add(v)
+	return c, true
+}
+
+func (r *runContainer) remove(v uint16) (container, bool) {
+	if !r.contains(v) {
+		return r, false
+	}
+	c, _ := toNonRun(r).remove(v)
+	return c, true
+}
+
+func (r *runContainer) cardinality() int {
+	card := 0
+	for _, run := range r.runs {
+		card += int(run.length) + 1
+	}
+	return card
+}
+
+func (r *runContainer) rank(v uint16) int {
+	rank := 0
+	for _, run := range r.runs {
+		if run.start > v {
+			break
+		}
+		rank += min(run.end(), int(v)) - int(run.start) + 1
+	}
+	return rank
+}
+
+func (r *runContainer) selectAt(i int) uint16 {
+	for _, run := range r.runs {
+		if i <= int(run.length) {
+			return run.start + uint16(i)
+		}
+		i -= int(run.length) + 1
+	}
+	panic("set: select past the end of a run container")
+}
+
+func (r *runContainer) iterate(fn func(uint16) bool) bool {
+	for _, run := range r.runs {
+		for v := int(run.start); v <= run.end(); v++ {
+			if !fn(uint16(v)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *runContainer) numRuns() int {
+	return len(r.runs)
+}
+
+func (r *runContainer) clone() container {
+	return &runContainer{runs: append([]interval(nil), r.runs...)}
+}
+
+func toBitmap(c container) *bitmapContainer {
+	if b, ok := c.(*bitmapContainer); ok {
+		return b
+	}
+	b := &bitmapContainer{}
+	c.iterate(func(v uint16) bool {
+		b.words[v>>6] |= 1 << (v & 63)
+		return true
+	})
+	b.card = c.cardinality()
+	return b
+}
+
+func toArray(c container) *arrayContainer {
+	if a, ok := c.(*arrayContainer); ok {
+		return a
+	}
+	a := &arrayContainer{values: make([]uint16, 0, c.cardinality())}
+	c.iterate(func(v uint16) bool {
+		a.values = append(a.values, v)
+		return true
+	})
+	return a
+}
+
+func toRun(c container) *runContainer {
+	if r, ok := c.(*runContainer); ok {
+		return r
+	}
+	r := &runContainer{runs: make([]interval, 0, c.numRuns())}
+	c.iterate(func(v uint16) bool {
+		if n := len(r.runs); n > 0 && r.runs[n-1].end()+1 == int(v) {
+			r.runs[n-1].length++
+			return true
+		}
+		r.runs = append(r.runs, interval{start: v})
+		return true
+	})
+	return r
+}
+
+// toNonRun returns an array or bitmap, whichever suits the cardinality of c
+func toNonRun(c container) container {
+	if c.cardinality() <= maxArraySize {
+		return toArray(c)
+	}
+	return toBitmap(c)
+}
+
+// runOptimize returns the smallest representation of c
+func runOptimize(c container) container {
+	card := c.cardinality()
+	nonRunSize := 8 * bitmapWords
+	if card <= maxArraySize {
+		nonRunSize = 2 * card
+	}
+	if 2+4*c.numRuns() < nonRunSize {
+		return toRun(c)
+	}
+	return toNonRun(c)
+}
+
+// unionContainers returns a new container with the members of both a and b
+func unionContainers(a, b container) container {
+	a, b = toNonRun(a), toNonRun(b)
+	aa, aArray := a.(*arrayContainer)
+	ba, bArray := b.(*arrayContainer)
+	if aArray && bArray {
+		values := make([]uint16, 0, len(aa.values)+len(ba.values))
+		i, j := 0, 0
+		for i < len(aa.values) && j < len(ba.values) {
+			switch x, y := aa.values[i], ba.values[j]; {
+			case x < y:
+				values = append(values, x)
+				i++
+			case x > y:
+				values = append(values, y)
+				j++
+			default:
+				values = append(values, x)
+				i++
+				j++
+			}
+		}
+		values = append(append(values, aa.values[i:]...), ba.values[j:]...)
+		return toNonRun(&arrayContainer{values: values})
+	}
+
+	if aArray {
+		a, b = b, a
+	}
+	result := a.clone().(*bitmapContainer)
+	if bb, ok := b.(*bitmapContainer); ok {
+		for i := range result.words {
+			result.words[i] |= bb.words[i]
+		}
+		result.recount()
+		return result
+	}
+	b.iterate(func(v uint16) bool {
+		result.add(v)
+		return true
+	})
+	return result
+}
+
+// intersectContainers returns a new container with the members common to a and
+// b, or nil if there are none
+func intersectContainers(a, b container) container {
+	a, b = toNonRun(a), toNonRun(b)
+	if _, ok := a.(*arrayContainer); !ok {
+		a, b = b, a
+	}
+	if aa, ok := a.(*arrayContainer); ok {
+		values := make([]uint16, 0, min(len(aa.values), b.cardinality()))
+		for _, v := range aa.values {
+			if b.contains(v) {
+				values = append(values, v)
+			}
+		}
+		return nonEmpty(&arrayContainer{values: values})
+	}
+
+	result := a.clone().(*bitmapContainer)
+	bb := b.(*bitmapContainer)
+	for i := range result.words {
+		result.words[i] &= bb.words[i]
+	}
+	result.recount()
+	return nonEmpty(toNonRun(result))
+}
+
+// differenceContainers returns a new container with the members of a that
+// aren't in b, or nil if there are none
+func differenceContainers(a, b container) container {
+	a, b = toNonRun(a), toNonRun(b)
+	if aa, ok := a.(*arrayContainer); ok {
+		values := make([]uint16, 0, len(aa.values))
+		for _, v := range aa.values {
+			if !b.contains(v) {
+				values = append(values, v)
+			}
+		}
+		return nonEmpty(&arrayContainer{values: values})
+	}
+
+	result := a.clone().(*bitmapContainer)
+	if bb, ok := b.(*bitmapContainer); ok {
+		for i := range result.words {
+			result.words[i] &^= bb.words[i]
+		}
+	} else {
+		b.iterate(func(v uint16) bool {
+			result.words[v>>6] &^= 1 << (v & 63)
+			return true
+		})
+	}
+	result.recount()
+	return nonEmpty(toNonRun(result))
+}
+
+// containsContainer is true if every member of inner is in outer
+func containsContainer(outer, inner container) bool {
+	if inner.cardinality() > outer.cardinality() {
+		return false
+	}
+	return inner.iterate(outer.contains)
+}
+
+func nonEmpty(c container) container {
+	if c.cardinality() == 0 {
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,258 @@
+package set
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Constants from the Roaring format spec, https://github.com/RoaringBitmap/RoaringFormatSpec
+const (
+	serialCookieNoRunContainer = 12346
+	serialCookie               = 12347
+	noOffsetThreshold          = 4
+)
+
+var (
+	// ErrInvalidRoaring when Roaring.UnmarshalBinary is given data that isn't a valid serialized bitmap
+	ErrInvalidRoaring = errors.New("invalid serialized roaring bitmap")
+)
+
+// MarshalBinary encodes the bitmap in the portable Roaring format, so it can be
+// read by any other Roaring implementation
+func (r *Roaring) MarshalBinary() ([]byte, error) {
+	r.lock(false)
+	defer r.unlock(false)
+
+	n := len(r.containers)
+	hasRun := false
+	for _, c := range r.containers {
+		if _, ok := c.(*runContainer); ok {
+			hasRun = true
+			break
+		}
+	}
+
+	var buf []byte
+	if hasRun {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(serialCookie)|uint32(n-1)<<16)
+		runFlags := make([]byte, (n+7)/8)
+		for i, c := range r.containers {
+			if _, ok := c.(*runContainer); ok {
+				runFlags[i/8] |= 1 << (i % 8)
+			}
+		}
+		buf = append(buf, runFlags...)
+	} else {
+		buf = binary.LittleEndian.AppendUint32(buf, serialCookieNoRunContainer)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+	}
+
+	for i, c := range r.containers {
+		buf = binary.LittleEndian.AppendUint16(buf, r.keys[i])
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(c.cardinality()-1))
+	}
+
+	if !hasRun || n >= noOffsetThreshold {
+		offset := len(buf) + 4*n
+		for _, c := range r.containers {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(offset))
+			offset += serializedSize(c)
+		}
+	}
+
+	for _, c := range r.containers {
+		buf = appendContainer(buf, c)
+	}
+	return buf, nil
+}
+
+func serializedSize(c container) int {
+	if r, ok := c.(*runContainer); ok {
+		return 2 + 4*len(r.runs)
+	}
+	if c.cardinality() <= maxArraySize {
+		return 2 * c.cardinality()
+	}
+	return 8 * bitmapWords
+}
+
+// appendContainer writes c in the format the spec implies from its cardinality
+// and run flag, regardless of how it's held in memory
+func appendContainer(buf []byte, c container) []byte {
+	if r, ok := c.(*runContainer); ok {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(r.runs)))
+		for _, run := range r.runs {
+			buf = binary.LittleEndian.AppendUint16(buf, run.start)
+			buf = binary.LittleEndian.AppendUint16(buf, run.length)
+		}
+		return buf
+	}
+
+	if c.cardinality() <= maxArraySize {
+		c.iterate(func(v uint16) bool {
+			buf = binary.LittleEndian.AppendUint16(buf, v)
+			return true
+		})
+		return buf
+	}
+
+	for _, w := range toBitmap(c).words {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	return buf
+}
+
+// UnmarshalBinary replaces the contents of the bitmap with data encoded in the
+// portable Roaring format
+func (r *Roaring) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	cookie := d.uint32()
+	var n int
+	var runFlags []byte
+	switch {
+	case cookie&0xFFFF == serialCookie:
+		n = int(cookie>>16) + 1
+		runFlags = d.bytes((n + 7) / 8)
+	case cookie == serialCookieNoRunContainer:
+		n = int(d.uint32())
+	default:
+		return ErrInvalidRoaring
+	}
+	if d.err != nil || n > 1<<16 {
+		return ErrInvalidRoaring
+	}
+
+	keys := make([]uint16, n)
+	cards := make([]int, n)
+	for i := range keys {
+		keys[i] = d.uint16()
+		cards[i] = int(d.uint16()) + 1
+		if i > 0 && keys[i] <= keys[i-1] {
+			return ErrInvalidRoaring
+		}
+	}
+	if runFlags == nil || n >= noOffsetThreshold {
+		d.bytes(4 * n)
+	}
+
+	containers := make([]container, n)
+	for i := range containers {
+		isRun := runFlags != nil && runFlags[i/8]&(1<<(i%8)) != 0
+		c, err := d.container(isRun, cards[i])
+		if err != nil {
+			return err
+		}
+		containers[i] = c
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	r.lock(true)
+	defer r.unlock(true)
+
+	r.keys, r.containers = keys, containers
+	return nil
+}
+
+// decoder reads little endian values, it records the first error and returns zeroes after it
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.data) {
+		d.err = ErrInvalidRoaring
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) container(isRun bool, card int) (container, error) {
+	if isRun {
+		r := &runContainer{runs: make([]interval, d.uint16())}
+		for i := range r.runs {
+			r.runs[i] = interval{start: d.uint16(), length: d.uint16()}
+			if r.runs[i].end() > 0xFFFF || (i > 0 && r.runs[i].start <= uint16(r.runs[i-1].end())) {
+				return nil, ErrInvalidRoaring
+			}
+		}
+		if d.err != nil || r.cardinality() != card {
+			return nil, ErrInvalidRoaring
+		}
+		return r, nil
+	}
+
+	if card <= maxArraySize {
+		a := &arrayContainer{values: make([]uint16, card)}
+		for i := range a.values {
+			a.values[i] = d.uint16()
+			if i > 0 && a.values[i] <= a.values[i-1] && d.err == nil {
+				return nil, ErrInvalidRoaring
+			}
+		}
+		return a, d.err
+	}
+
+	b := &bitmapContainer{}
+	for i := range b.words {
+		b.words[i] = d.uint64()
+	}
+	b.recount()
+	if d.err != nil || b.card != card {
+		return nil, ErrInvalidRoaring
+	}
+	return b, nil
+}
+
+// MarshalJSON encodes the members as a JSON array of numbers, it's meant for
+// debugging and interchange, MarshalBinary is far more compact
+func (r *Roaring) MarshalJSON() ([]byte, error) {
+	members := make([]uint32, 0, r.Cardinality())
+	for v := range r.All() {
+		members = append(members, v)
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON replaces the members of the bitmap with a JSON array of numbers
+func (r *Roaring) UnmarshalJSON(data []byte) error {
+	var members []uint32
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	r.lock(true)
+	defer r.unlock(true)
+
+	r.keys, r.containers = nil, nil
+	for _, v := range members {
+		r.add(v)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package set
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func roaringMembers(r *Roaring) []int {
+	var members []int
+	for v := range r.All() {
+		members = append(members, int(v))
+	}
+	return members
+}
+
+// randomRoaring builds a bitmap with a sparse, a dense and a consecutive chunk
+// so every kind of container is exercised, along with its expected members
+func randomRoaring(r *rand.Rand) (*Roaring, map[int]bool) {
+	bitmap, reference := NewRoaring(), make(map[int]bool)
+	add := func(v int) {
+		bitmap.Add(uint32(v))
+		reference[v] = true
+	}
+	for i := 0; i < 500; i++ {
+		add(r.Intn(1 << 16))
+	}
+	for i := 0; i < 20000; i++ {
+		add(1<<16 + r.Intn(1<<16))
+	}
+	start := 2<<16 + r.Intn(1000)
+	for v := start; v < start+r.Intn(10000); v++ {
+		add(v)
+	}
+	add(1<<32 - 1)
+	return bitmap, reference
+}
+
+func sortedKeys(m map[int]bool) []int {
+	keys := make([]int, 0, len(m))
+	for k, v := range m {
+		if v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func TestRoaringAddRemove(t *testing.T) {
+	fmt.Println("TestRoaringAddRemove")
+	r := NewRoaring()
+	assertOperation(t, "add 1", r.Add(1), true)
+	assertOperation(t, "add 1 again", r.Add(1), false)
+	assertOperation(t, "add max", r.Add(1<<32-1), true)
+	assertOperation(t, "contains max", r.Contains(1<<32-1), true)
+	assertOperation(t, "contains 2", r.Contains(2), false)
+	assertOperation(t, "remove 2", r.Remove(2), false)
+	assertOperation(t, "remove max", r.Remove(1<<32-1), true)
+	assertIntsEqual(t, "members", []int{1}, roaringMembers(r))
+
+	// crossing the array size turns the container into a bitmap and back again
+	r.Empty()
+	for v := uint32(0); v <= maxArraySize; v++ {
+		r.Add(v * 2)
+	}
+	if _, ok := r.containers[0].(*bitmapContainer); !ok {
+		t.Errorf("Expected a bitmap container past %d members", maxArraySize)
+	}
+	r.Remove(0)
+	if _, ok := r.containers[0].(*arrayContainer); !ok {
+		t.Errorf("Expected an array container at %d members", maxArraySize)
+	}
+	if card := r.Cardinality(); card != maxArraySize {
+		t.Errorf("Expected cardinality %d, got %d", maxArraySize, card)
+	}
+
+	r.Empty()
+	assertOperation(t, "empty bitmap has no members", r.Cardinality() == 0, true)
+}
+
+func TestRoaringRankSelect(t *testing.T) {
+	fmt.Println("TestRoaringRankSelect")
+	bitmap, reference := randomRoaring(rand.New(rand.NewSource(1)))
+	members := sortedKeys(reference)
+	for _, optimize := range []bool{false, true} {
+		if optimize {
+			bitmap.RunOptimize()
+		}
+		for i := 0; i < len(members); i += 97 {
+			v, found := bitmap.Select(uint64(i))
+			if !found || int(v) != members[i] {
+				t.Errorf("Expected select %d to be %d, got %d", i, members[i], v)
+			}
+			if rank := bitmap.Rank(uint32(members[i])); rank != uint64(i+1) {
+				t.Errorf("Expected rank of %d to be %d, got %d", members[i], i+1, rank)
+			}
+		}
+		if _, found := bitmap.Select(uint64(len(members))); found {
+			t.Errorf("Did not expect to select past the end of the bitmap")
+		}
+		if card := bitmap.Cardinality(); card != uint64(len(members)) {
+			t.Errorf("Expected cardinality %d, got %d", len(members), card)
+		}
+	}
+}
+
+func TestRoaringOperations(t *testing.T) {
+	fmt.Println("TestRoaringOperations")
+	r := rand.New(rand.NewSource(2))
+	b1, r1 := randomRoaring(r)
+	b2, r2 := randomRoaring(r)
+	b2.RunOptimize()
+
+	union, intersection, difference := make(map[int]bool), make(map[int]bool), make(map[int]bool)
+	for v := range r1 {
+		union[v] = true
+		intersection[v] = r2[v]
+		difference[v] = !r2[v]
+	}
+	for v := range r2 {
+		union[v] = true
+	}
+	assertIntsEqual(t, "union", sortedKeys(union), roaringMembers(b1.Union(b2)))
+	assertIntsEqual(t, "intersection", sortedKeys(intersection), roaringMembers(b1.Intersection(b2)))
+	assertIntsEqual(t, "difference", sortedKeys(difference), roaringMembers(b1.Difference(b2)))
+
+	assertOperation(t, "union is a superset", b1.Superset(b1.Union(b2)), true)
+	assertOperation(t, "intersection is a subset", b1.Subset(b1.Intersection(b2)), true)
+	assertOperation(t, "difference isn't a superset", b2.Subset(b1.Difference(b2)), false)
+	assertOperation(t, "equal to itself", b1.Equal(b1), true)
+	assertOperation(t, "not equal to another", b1.Equal(b2), false)
+	assertOperation(t, "empty difference with self", b1.Difference(b1).Cardinality() == 0, true)
+}
+
+func TestRoaringRunOptimize(t *testing.T) {
+	fmt.Println("TestRoaringRunOptimize")
+	r := NewRoaring()
+	for v := uint32(100); v < 50000; v++ {
+		r.Add(v)
+	}
+	before := roaringMembers(r)
+	r.RunOptimize()
+	if _, ok := r.containers[0].(*runContainer); !ok {
+		t.Errorf("Expected a consecutive range to become a run container")
+	}
+	assertIntsEqual(t, "members after run optimize", before, roaringMembers(r))
+
+	assertOperation(t, "add to a run container", r.Add(70000), true)
+	assertOperation(t, "remove from a run container", r.Remove(200), true)
+	assertOperation(t, "contains removed member", r.Contains(200), false)
+	assertOperation(t, "contains a member of the run", r.Contains(201), true)
+}
+
+// TestRoaringSerializeFormat checks the bytes written against the layout in the Roaring format spec
+func TestRoaringSerializeFormat(t *testing.T) {
+	fmt.Println("TestRoaringSerializeFormat")
+	var tests = []struct {
+		bitmap   *Roaring
+		expected []byte
+	}{
+		{NewRoaring(), []byte{0x3A, 0x30, 0, 0, 0, 0, 0, 0}},
+		{NewRoaringOf(1, 2, 3), []byte{
+			0x3A, 0x30, 0, 0, 1, 0, 0, 0, // cookie and container count
+			0, 0, 2, 0, // key and cardinality - 1
+			16, 0, 0, 0, // offset
+			1, 0, 2, 0, 3, 0, // array container
+		}},
+		{runBitmap(), []byte{
+			0x3B, 0x30, 0, 0, // cookie with container count - 1
+			1,           // run flags
+			0, 0, 99, 0, // key and cardinality - 1
+			1, 0, 1, 0, 99, 0, // run container with one run
+		}},
+	}
+	for i, test := range tests {
+		data, err := test.bitmap.MarshalBinary()
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		if !bytes.Equal(data, test.expected) {
+			t.Errorf("Case %d failed, expected % x, got % x", i+1, test.expected, data)
+		}
+	}
+}
+
+func runBitmap() *Roaring {
+	r := NewRoaring()
+	for v := uint32(1); v <= 100; v++ {
+		r.Add(v)
+	}
+	r.RunOptimize()
+	return r
+}
+
+func TestRoaringSerializeRoundTrip(t *testing.T) {
+	fmt.Println("TestRoaringSerializeRoundTrip")
+	rng := rand.New(rand.NewSource(3))
+	for _, optimize := range []bool{false, true} {
+		bitmap, _ := randomRoaring(rng)
+		if optimize {
+			bitmap.RunOptimize()
+		}
+		data, err := bitmap.MarshalBinary()
+		if err != nil {
+			t.Error(err)
+		}
+		decoded := NewRoaring()
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Error(err)
+		}
+		assertOperation(t, "round trip is equal", decoded.Equal(bitmap), true)
+		again, _ := decoded.MarshalBinary()
+		assertOperation(t, "round trip is byte for byte identical", bytes.Equal(data, again), true)
+	}
+}
+
+func TestRoaringUnmarshalInvalid(t *testing.T) {
+	fmt.Println("TestRoaringUnmarshalInvalid")
+	valid, _ := NewRoaringOf(1, 2, 3).MarshalBinary()
+	var tests = [][]byte{
+		nil,
+		{1, 2, 3, 4},
+		valid[:len(valid)-1],
+		{0x3A, 0x30, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 16, 0, 0, 0, 2, 0, 1, 0}, // unsorted array
+	}
+	for i, data := range tests {
+		if err := NewRoaring().UnmarshalBinary(data); err != ErrInvalidRoaring {
+			t.Errorf("Case %d failed, expected error %s, got [%v] instead", i+1, ErrInvalidRoaring, err)
+		}
+	}
+}
@@ -1,8 +1,22 @@
 package set
 
-import "sync"
+import (
+	"context"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
 
 // Set is a data structure that will contain all unqiue Items
+//
+// Every method of a Set is safe for concurrent use. The package level
+// operations (Union, Intersection, Equal, etc.) hold a read lock on each of
+// their operands for the duration of the operation, so they see a consistent
+// view of every set involved. Methods that take another Set, like UnionWith,
+// write lock the receiver and read lock the argument. Locks on multiple sets are
+// always acquired in the same global order so these operations can't deadlock
+// each other. Predicates and Comparators are invoked while those locks are held
+// and must not call back into the sets being operated on.
 type Set interface {
 	Get(Item) (Item, bool)
 	Add(Item) bool
@@ -10,10 +24,25 @@ type Set interface {
 	Contains(Item) bool
 	Empty()
 	Size() int
+	All() iter.Seq[Item]
+	Select(pred Predicate, limit int) iter.Seq[Item]
+	IterateCtx(ctx context.Context, pred Predicate, limit int) <-chan Item
+	Snapshot() []Item
+	UnionWith(other Set) int
+	IntersectWith(other Set) int
+	DifferenceWith(other Set) int
+	RetainIf(pred Predicate) int
+	RemoveIf(pred Predicate) int
+
+	// Deprecated: IterateAll leaks a goroutine if the channel isn't drained, use All or IterateCtx
 	IterateAll() <-chan Item
+	// Deprecated: Iterate leaks a goroutine if the channel isn't drained, use Select or IterateCtx
 	Iterate(pred Predicate, limit int) <-chan Item
 
 	data() map[string]Item
+	lock(write bool)
+	unlock(write bool)
+	order() uint64
 }
 
 // Item is something in the Set
@@ -33,25 +62,110 @@ const (
 // Comparator compares two items for equality
 type Comparator func(i1, i2 Item) Comparison
 
+// sequence hands out the ordering key used to lock multiple sets without deadlocking
+var sequence uint64
+
 // NewSet returns a Set that om
 func NewSet() Set {
 	s := &set{
-		m:    make(map[string]Item),
-		lock: &sync.RWMutex{},
+		m:     make(map[string]Item),
+		mutex: &sync.RWMutex{},
+		seq:   atomic.AddUint64(&sequence, 1),
 	}
 	return s
 }
 
 type set struct {
-	lock *sync.RWMutex
-	m    map[string]Item
+	mutex *sync.RWMutex
+	m     map[string]Item
+	seq   uint64
 }
 
+// data returns the underlying map, callers must hold the set's lock
 func (s *set) data() map[string]Item {
 	return s.m
 }
 
+func (s *set) lock(write bool) {
+	if write {
+		s.mutex.Lock()
+		return
+	}
+
+	s.mutex.RLock()
+}
+
+func (s *set) unlock(write bool) {
+	if write {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.mutex.RUnlock()
+}
+
+func (s *set) order() uint64 {
+	return s.seq
+}
+
+// rlockAll read locks every distinct set in ascending order() and returns the
+// function that releases them. Acquiring locks in one global order means two
+// operations over the same sets can never each hold the lock the other wants.
+func rlockAll(many ...Set) func() {
+	locked := make([]Set, 0, len(many))
+	for _, s := range many {
+		duplicate := false
+		for _, l := range locked {
+			if l.order() == s.order() {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			locked = append(locked, s)
+		}
+	}
+	for i := 1; i < len(locked); i++ {
+		for j := i; j > 0 && locked[j].order() < locked[j-1].order(); j-- {
+			locked[j], locked[j-1] = locked[j-1], locked[j]
+		}
+	}
+
+	for _, s := range locked {
+		s.lock(false)
+	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].unlock(false)
+		}
+	}
+}
+
+// lockWith write locks w and read locks r in ascending order() and returns the
+// function that releases them, if they're the same set only the write lock is taken
+func lockWith(w, r Set) func() {
+	if w.order() == r.order() {
+		w.lock(true)
+		return func() { w.unlock(true) }
+	}
+
+	if w.order() < r.order() {
+		w.lock(true)
+		r.lock(false)
+	} else {
+		r.lock(false)
+		w.lock(true)
+	}
+	return func() {
+		r.unlock(false)
+		w.unlock(true)
+	}
+}
+
 func (s *set) Get(item Item) (Item, bool) {
+	s.lock(false)
+	defer s.unlock(false)
+
 	if value, exists := s.m[item.Key()]; exists {
 		return value, exists
 	}
@@ -59,8 +173,8 @@ func (s *set) Get(item Item) (Item, bool) {
 }
 
 func (s *set) Add(item Item) bool {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	s.lock(true)
+	defer s.unlock(true)
 
 	if _, exists := s.m[item.Key()]; exists {
 		return false
@@ -71,8 +185,8 @@ func (s *set) Add(item Item) bool {
 }
 
 func (s *set) Remove(item Item) bool {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	s.lock(true)
+	defer s.unlock(true)
 
 	if _, exists := s.m[item.Key()]; !exists {
 		return false
@@ -83,18 +197,24 @@ func (s *set) Remove(item Item) bool {
 }
 
 func (s *set) Contains(item Item) bool {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	s.lock(false)
+	defer s.unlock(false)
 
 	_, exists := s.m[item.Key()]
 	return exists
 }
 
 func (s *set) Empty() {
+	s.lock(true)
+	defer s.unlock(true)
+
 	s.m = make(map[string]Item)
 }
 
 func (s *set) Size() int {
+	s.lock(false)
+	defer s.unlock(false)
+
 	return len(s.m)
 }
 
@@ -103,6 +223,8 @@ type Predicate func(Item) bool
 
 // Union returns the union of s1 and s2 such that the values of keys of s1 are taken first
 func Union(s1, s2 Set) (Set, error) {
+	defer rlockAll(s1, s2)()
+
 	union := NewSet()
 	for _, item := range s1.data() {
 		union.Add(item)
@@ -119,15 +241,16 @@ func Union(s1, s2 Set) (Set, error) {
 
 // Intersection returns a set containing mutual items of s1 and s2
 func Intersection(s1, s2 Set) (Set, error) {
+	defer rlockAll(s1, s2)()
+
 	intersection := NewSet()
 
-	larger, smaller := s1, s2
-	if s2.Size() > s1.Size() {
-		larger = s2
-		smaller = s1
+	larger, smaller := s1.data(), s2.data()
+	if len(smaller) > len(larger) {
+		larger, smaller = smaller, larger
 	}
-	for key, item := range larger.data() {
-		if _, exists := smaller.data()[key]; !exists {
+	for key, item := range larger {
+		if _, exists := smaller[key]; !exists {
 			continue
 		}
 		intersection.Add(item)
@@ -137,9 +260,11 @@ func Intersection(s1, s2 Set) (Set, error) {
 
 // Difference s1-s2 is all elements in s1 that aren't in s2
 func Difference(s1, s2 Set) (Set, error) {
-	diff := NewSet()
-	for _, item := range s1.data() {
-		if !s2.Contains(item) {
+	defer rlockAll(s1, s2)()
+
+	diff, exclude := NewSet(), s2.data()
+	for key, item := range s1.data() {
+		if _, exists := exclude[key]; !exists {
 			diff.Add(item)
 		}
 	}
@@ -149,6 +274,8 @@ func Difference(s1, s2 Set) (Set, error) {
 
 // Filter returns a set with only the items matching the predicate from all the sets
 func Filter(p Predicate, many ...Set) (Set, error) {
+	defer rlockAll(many...)()
+
 	filtered := NewSet()
 	for _, s := range many {
 		for _, item := range s.data() {
@@ -165,13 +292,23 @@ func Filter(p Predicate, many ...Set) (Set, error) {
 
 // Equal returns true if two sets have the same Items
 func Equal(s1, s2 Set) bool {
-	// TODO: locks?
-	if len(s1.data()) != len(s2.data()) {
+	defer rlockAll(s1, s2)()
+
+	return sameKeys(s1.data(), s2.data())
+}
+
+func sameKeys(m1, m2 map[string]Item) bool {
+	if len(m1) != len(m2) {
 		return false
 	}
 
-	for _, item := range s1.data() {
-		if !s2.Contains(item) {
+	return contains(m1, m2)
+}
+
+// contains is true if every key of inner is in outer
+func contains(outer, inner map[string]Item) bool {
+	for key := range inner {
+		if _, exists := outer[key]; !exists {
 			return false
 		}
 	}
@@ -181,50 +318,39 @@ func Equal(s1, s2 Set) bool {
 
 // Subset determines if s2 is a subset of s1
 func Subset(s1, s2 Set) bool {
-	if s2.Size() > s1.Size() {
-		return false
-	}
-
-	if s2.Size() == s1.Size() {
-		return Equal(s1, s2)
-	}
+	defer rlockAll(s1, s2)()
 
-	for _, item := range s2.data() {
-		if !s1.Contains(item) {
-			return false
-		}
+	m1, m2 := s1.data(), s2.data()
+	if len(m2) > len(m1) {
+		return false
 	}
 
-	return true
+	return contains(m1, m2)
 }
 
 // Superset determines if s2 is a super set of s1
 func Superset(s1, s2 Set) bool {
-	if s2.Size() < s1.Size() {
-		return false
-	}
+	defer rlockAll(s1, s2)()
 
-	if s2.Size() == s1.Size() {
-		return Equal(s1, s2)
-	}
-
-	for _, item := range s1.data() {
-		if !s2.Contains(item) {
-			return false
-		}
+	m1, m2 := s1.data(), s2.data()
+	if len(m2) < len(m1) {
+		return false
 	}
 
-	return true
+	return contains(m2, m1)
 }
 
 // DeepEqual is like Equal but also makes sure the sets have the same values
 func DeepEqual(s1, s2 Set, comp Comparator) bool {
-	if s1.Size() != s2.Size() {
+	defer rlockAll(s1, s2)()
+
+	m1, m2 := s1.data(), s2.data()
+	if len(m1) != len(m2) {
 		return false
 	}
 
-	for item := range s1.IterateAll() {
-		item2, exists := s2.Get(item)
+	for key, item := range m1 {
+		item2, exists := m2[key]
 		if !exists || comp(item, item2) != equal {
 			return false
 		}
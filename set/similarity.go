@@ -0,0 +1,220 @@
+package set
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	// ErrMinHashMismatch when comparing or merging MinHash signatures of different lengths or seeds
+	ErrMinHashMismatch = errors.New("cannot combine MinHash signatures with different parameters")
+)
+
+// Jaccard returns |s1 ∩ s2| / |s1 ∪ s2|, two empty sets are identical so their similarity is 1
+func Jaccard(s1, s2 Set) float64 {
+	n1, n2, common := overlap(s1, s2)
+	return ratio(float64(common), float64(n1+n2-common), n1, n2)
+}
+
+// SorensenDice returns 2|s1 ∩ s2| / (|s1| + |s2|), two empty sets are identical so their similarity is 1
+func SorensenDice(s1, s2 Set) float64 {
+	n1, n2, common := overlap(s1, s2)
+	return ratio(float64(2*common), float64(n1+n2), n1, n2)
+}
+
+// Overlap returns |s1 ∩ s2| / min(|s1|, |s2|), two empty sets are identical so their similarity is 1
+func Overlap(s1, s2 Set) float64 {
+	n1, n2, common := overlap(s1, s2)
+	return ratio(float64(common), float64(min(n1, n2)), n1, n2)
+}
+
+// Cosine returns the cosine similarity of the sets' membership vectors,
+// |s1 ∩ s2| / sqrt(|s1||s2|), two empty sets are identical so their similarity is 1
+func Cosine(s1, s2 Set) float64 {
+	n1, n2, common := overlap(s1, s2)
+	return ratio(float64(common), math.Sqrt(float64(n1)*float64(n2)), n1, n2)
+}
+
+// ratio divides numerator by denominator, when the denominator is zero at least
+// one set is empty and they're similar only if both are
+func ratio(numerator, denominator float64, n1, n2 int) float64 {
+	if denominator == 0 {
+		if n1 == 0 && n2 == 0 {
+			return 1
+		}
+		return 0
+	}
+	return numerator / denominator
+}
+
+// overlap returns the sizes of both sets and of their intersection without
+// building any sets. A striped set is read a stripe at a time instead of through
+// data(), which copies it, so the result is weakly consistent like the package
+// level operations. An Item lands in stripe hash&(stripes-1), so stripe j of
+// the set with more stripes can only share Items with stripe j&(stripes-1) of
+// the other, and each of those pairs is compared once.
+func overlap(s1, s2 Set) (n1, n2, common int) {
+	k1, k2 := stripeCount(s1), stripeCount(s2)
+	for j := 0; j < max(k1, k2); j++ {
+		size1, size2, c := overlapStripes(stripeOf(s1, j&(k1-1)), stripeOf(s2, j&(k2-1)))
+		// a stripe of the set with fewer stripes is compared more than once, count its size once
+		if j < k1 {
+			n1 += size1
+		}
+		if j < k2 {
+			n2 += size2
+		}
+		common += c
+	}
+	return n1, n2, common
+}
+
+// stripeCount is the number of stripes of s, a power of two, a set that isn't striped has one
+func stripeCount(s Set) int {
+	if striped, ok := s.(*stripedSet); ok {
+		return len(striped.stripes)
+	}
+	return 1
+}
+
+// stripeOf returns stripe i of s, a set that isn't striped is its only stripe
+func stripeOf(s Set, i int) Set {
+	if striped, ok := s.(*stripedSet); ok {
+		return striped.stripes[i]
+	}
+	return s
+}
+
+// overlapStripes is overlap for sets that aren't striped, it takes the read
+// locks without rlockAll since that allocates
+func overlapStripes(s1, s2 Set) (n1, n2, common int) {
+	first, second := s1, s2
+	if second.order() < first.order() {
+		first, second = second, first
+	}
+	first.lock(false)
+	defer first.unlock(false)
+	if second.order() != first.order() {
+		second.lock(false)
+		defer second.unlock(false)
+	}
+
+	m1, m2 := s1.data(), s2.data()
+	smaller, larger := m1, m2
+	if len(smaller) > len(larger) {
+		smaller, larger = larger, smaller
+	}
+	for key := range smaller {
+		if _, exists := larger[key]; exists {
+			common++
+		}
+	}
+	return len(m1), len(m2), common
+}
+
+// MinHash is a signature of a set that estimates the Jaccard similarity of two
+// sets without either of them being kept around. Each of its k slots holds the
+// minimum of a different hash over the Keys added, and the fraction of slots
+// two signatures agree on estimates their Jaccard similarity with a standard
+// error of about 1/sqrt(k).
+//
+// The hashes are derived from seed, so signatures built with the same k and
+// seed can be compared or merged even across processes. A MinHash isn't safe
+// for concurrent use.
+type MinHash struct {
+	mins []uint64
+	seed uint64
+}
+
+// NewMinHash returns an empty signature with k slots
+func NewMinHash(k int, seed uint64) *MinHash {
+	m := &MinHash{mins: make([]uint64, k), seed: seed}
+	for i := range m.mins {
+		m.mins[i] = math.MaxUint64
+	}
+	return m
+}
+
+// MinHashOf returns a signature of a snapshot of s
+func MinHashOf(s Set, k int, seed uint64) *MinHash {
+	m := NewMinHash(k, seed)
+	for _, item := range s.Snapshot() {
+		m.Add(item)
+	}
+	return m
+}
+
+// Add includes item in the signature
+func (m *MinHash) Add(item Item) {
+	m.AddKey(item.Key())
+}
+
+// AddKey includes an Item's key in the signature, it doesn't allocate
+func (m *MinHash) AddKey(key string) {
+	h := fnv64a(key) ^ m.seed
+	for i := range m.mins {
+		// each slot's hash is the base hash mixed with a different constant
+		if v := splitmix64(h + uint64(i)*0x9E3779B97F4A7C15); v < m.mins[i] {
+			m.mins[i] = v
+		}
+	}
+}
+
+// Similarity estimates the Jaccard similarity of the sets behind m and other
+func (m *MinHash) Similarity(other *MinHash) (float64, error) {
+	if !m.compatible(other) {
+		return 0, ErrMinHashMismatch
+	}
+	if len(m.mins) == 0 {
+		return 0, nil
+	}
+
+	same := 0
+	for i, v := range m.mins {
+		if v == other.mins[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(m.mins)), nil
+}
+
+// Merge makes m the signature of the union of its set and other's
+func (m *MinHash) Merge(other *MinHash) error {
+	if !m.compatible(other) {
+		return ErrMinHashMismatch
+	}
+
+	for i, v := range other.mins {
+		m.mins[i] = min(m.mins[i], v)
+	}
+	return nil
+}
+
+// Signature returns a copy of the slot values
+func (m *MinHash) Signature() []uint64 {
+	return append([]uint64(nil), m.mins...)
+}
+
+func (m *MinHash) compatible(other *MinHash) bool {
+	return len(m.mins) == len(other.mins) && m.seed == other.seed
+}
+
+// fnv64a hashes a string with FNV-1a without converting it to a []byte
+func fnv64a(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// splitmix64 is the finalizer of the SplitMix64 generator, a fast bijective mixer
+func splitmix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xBF58476D1CE4E5B9
+	x ^= x >> 27
+	x *= 0x94D049BB133111EB
+	x ^= x >> 31
+	return x
+}
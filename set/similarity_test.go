@@ -0,0 +1,137 @@
+package set
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func assertFloat(t *testing.T, msg string, expected, actual, tolerance float64) {
+	if math.Abs(expected-actual) > tolerance {
+		t.Errorf("%s -- expected:%f actual:%f", msg, expected, actual)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	fmt.Println("TestSimilarity")
+	var tests = []struct {
+		s1, s2                         Set
+		jaccard, dice, overlap, cosine float64
+	}{
+		{getPopulatedSet(1, 10), getPopulatedSet(1, 10), 1, 1, 1, 1},
+		{getPopulatedSet(1, 10), getPopulatedSet(11, 20), 0, 0, 0, 0},
+		{getPopulatedSet(1, 10), getPopulatedSet(6, 15), 5.0 / 15, 10.0 / 20, 5.0 / 10, 5.0 / 10},
+		{getPopulatedSet(1, 4), getPopulatedSet(1, 16), 4.0 / 16, 8.0 / 20, 1, 4.0 / 8},
+		{getPopulatedSet(1, 0), getPopulatedSet(1, 0), 1, 1, 1, 1},
+		{getPopulatedSet(1, 0), getPopulatedSet(1, 5), 0, 0, 0, 0},
+	}
+	for i, test := range tests {
+		msg := fmt.Sprintf("case %d", i+1)
+		assertFloat(t, msg+" jaccard", test.jaccard, Jaccard(test.s1, test.s2), 1e-9)
+		assertFloat(t, msg+" dice", test.dice, SorensenDice(test.s1, test.s2), 1e-9)
+		assertFloat(t, msg+" overlap", test.overlap, Overlap(test.s1, test.s2), 1e-9)
+		assertFloat(t, msg+" cosine", test.cosine, Cosine(test.s1, test.s2), 1e-9)
+	}
+	s := getPopulatedSet(1, 5)
+	assertFloat(t, "jaccard with itself", 1, Jaccard(s, s), 0)
+}
+
+func TestSimilarityStriped(t *testing.T) {
+	fmt.Println("TestSimilarityStriped")
+	variants := []func() Set{
+		NewSet,
+		func() Set { return NewStripedSet(4) },
+		func() Set { return NewStripedSet(16) },
+		func() Set { return NewOrderedSet(testComparator) },
+	}
+	expected := getPopulatedSet(1, 100)
+	other := getPopulatedSet(50, 150)
+	for i, create1 := range variants {
+		for j, create2 := range variants {
+			s1, s2 := create1(), create2()
+			populateSet(s1, 1, 100)
+			populateSet(s2, 50, 150)
+			msg := fmt.Sprintf("variants %d and %d", i, j)
+			assertFloat(t, msg+" jaccard", Jaccard(expected, other), Jaccard(s1, s2), 0)
+			assertFloat(t, msg+" overlap", Overlap(expected, other), Overlap(s1, s2), 0)
+			assertFloat(t, msg+" cosine with itself", 1, Cosine(s1, s1), 0)
+		}
+	}
+}
+
+func TestSimilarityAllocations(t *testing.T) {
+	fmt.Println("TestSimilarityAllocations")
+	s1, s2 := getPopulatedSet(1, 100), getPopulatedSet(50, 150)
+	ordered := NewOrderedSet(testComparator)
+	populateSet(ordered, 1, 100)
+	striped, wide := NewStripedSet(4), NewStripedSet(16)
+	populateSet(striped, 1, 100)
+	populateSet(wide, 50, 150)
+	allocs := testing.AllocsPerRun(100, func() {
+		Jaccard(s1, s2)
+		SorensenDice(s1, ordered)
+		Overlap(s2, s1)
+		Cosine(s1, s1)
+		Jaccard(striped, s2)
+		Overlap(wide, striped)
+		Cosine(striped, striped)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected similarity to allocate nothing, got %f allocations", allocs)
+	}
+
+	m := NewMinHash(64, 1)
+	allocs = testing.AllocsPerRun(100, func() {
+		m.AddKey("key")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected MinHash.AddKey to allocate nothing, got %f allocations", allocs)
+	}
+}
+
+func TestMinHash(t *testing.T) {
+	fmt.Println("TestMinHash")
+	var tests = []struct {
+		s1, s2 Set
+	}{
+		{getPopulatedSet(1, 1000), getPopulatedSet(1, 1000)},
+		{getPopulatedSet(1, 1000), getPopulatedSet(501, 1500)},
+		{getPopulatedSet(1, 1000), getPopulatedSet(901, 1900)},
+		{getPopulatedSet(1, 1000), getPopulatedSet(1001, 2000)},
+	}
+	const k = 512
+	for i, test := range tests {
+		m1, m2 := MinHashOf(test.s1, k, 42), MinHashOf(test.s2, k, 42)
+		estimate, err := m1.Similarity(m2)
+		if err != nil {
+			t.Errorf("Error with case %d: %s", i+1, err)
+		}
+		// four standard errors
+		assertFloat(t, fmt.Sprintf("case %d estimate", i+1), Jaccard(test.s1, test.s2), estimate, 4/math.Sqrt(k))
+	}
+}
+
+func TestMinHashMerge(t *testing.T) {
+	fmt.Println("TestMinHashMerge")
+	m1, m2 := MinHashOf(getPopulatedSet(1, 50), 128, 7), MinHashOf(getPopulatedSet(51, 100), 128, 7)
+	if err := m1.Merge(m2); err != nil {
+		t.Error(err)
+	}
+	union := MinHashOf(getPopulatedSet(1, 100), 128, 7)
+	assertIntsEqual(t, "merged signature", toInts(union.Signature()), toInts(m1.Signature()))
+
+	if _, err := m1.Similarity(NewMinHash(128, 8)); err != ErrMinHashMismatch {
+		t.Errorf("Expected error %s, got [%v] instead", ErrMinHashMismatch, err)
+	}
+	if err := m1.Merge(NewMinHash(64, 7)); err != ErrMinHashMismatch {
+		t.Errorf("Expected error %s, got [%v] instead", ErrMinHashMismatch, err)
+	}
+}
+
+func toInts(values []uint64) []int {
+	ints := make([]int, len(values))
+	for i, v := range values {
+		ints[i] = int(v)
+	}
+	return ints
+}
@@ -0,0 +1,195 @@
+package set
+
+import (
+	"context"
+	"iter"
+	"sync/atomic"
+)
+
+// DefaultStripes is the number of stripes NewStripedSet uses when asked for none
+const DefaultStripes = 64
+
+// NewStripedSet returns a Set split into stripes, each a Set with its own lock,
+// chosen by the hash of an Item's Key. Operations on single Items only lock
+// their stripe, so concurrent writers rarely contend. stripes is rounded up to
+// a power of two, DefaultStripes is used if it's less than one.
+//
+// Operations spanning the whole set are weakly consistent: Size, Empty, the
+// iterators, Snapshot and the in-place methods visit the stripes one at a time,
+// and so do the package level operations when a StripedSet is one of their
+// operands. Each stripe is seen atomically and no Item is seen twice, but Items
+// added or removed in other stripes while the operation runs may or may not be
+// reflected, so the result may not match the set at any single instant.
+func NewStripedSet(stripes int) Set {
+	if stripes < 1 {
+		stripes = DefaultStripes
+	}
+	n := 1
+	for n < stripes {
+		n <<= 1
+	}
+
+	s := &stripedSet{
+		stripes: make([]Set, n),
+		mask:    uint64(n - 1),
+		seq:     atomic.AddUint64(&sequence, 1),
+	}
+	for i := range s.stripes {
+		s.stripes[i] = NewSet()
+	}
+	return s
+}
+
+type stripedSet struct {
+	stripes []Set
+	mask    uint64
+	seq     uint64
+}
+
+func (s *stripedSet) stripe(item Item) Set {
+	return s.stripes[hashKey(item.Key())&s.mask]
+}
+
+// data merges the stripes into a new map a stripe at a time, which is what
+// makes the package level operations weakly consistent over a stripedSet
+func (s *stripedSet) data() map[string]Item {
+	m := make(map[string]Item)
+	for _, stripe := range s.stripes {
+		for _, item := range stripe.Snapshot() {
+			m[item.Key()] = item
+		}
+	}
+	return m
+}
+
+// lock is a no-op, data() locks each stripe as it reads it and returns a copy
+// so there's nothing for the caller to hold a lock over
+func (s *stripedSet) lock(write bool) {}
+
+func (s *stripedSet) unlock(write bool) {}
+
+func (s *stripedSet) order() uint64 {
+	return s.seq
+}
+
+func (s *stripedSet) Get(item Item) (Item, bool) {
+	return s.stripe(item).Get(item)
+}
+
+func (s *stripedSet) Add(item Item) bool {
+	return s.stripe(item).Add(item)
+}
+
+func (s *stripedSet) Remove(item Item) bool {
+	return s.stripe(item).Remove(item)
+}
+
+func (s *stripedSet) Contains(item Item) bool {
+	return s.stripe(item).Contains(item)
+}
+
+func (s *stripedSet) Empty() {
+	for _, stripe := range s.stripes {
+		stripe.Empty()
+	}
+}
+
+func (s *stripedSet) Size() int {
+	size := 0
+	for _, stripe := range s.stripes {
+		size += stripe.Size()
+	}
+	return size
+}
+
+// snapshot collects up to limit Items matching pred a stripe at a time, a negative limit means no limit
+func (s *stripedSet) snapshot(pred Predicate, limit int) []Item {
+	var items []Item
+	for _, stripe := range s.stripes {
+		if limit >= 0 && len(items) >= limit {
+			break
+		}
+		remaining := -1
+		if limit >= 0 {
+			remaining = limit - len(items)
+		}
+		items = append(items, stripe.(*set).snapshot(pred, remaining)...)
+	}
+	return items
+}
+
+func (s *stripedSet) Snapshot() []Item {
+	return s.snapshot(PredicateAll, -1)
+}
+
+func (s *stripedSet) All() iter.Seq[Item] {
+	return s.Select(PredicateAll, -1)
+}
+
+func (s *stripedSet) Select(pred Predicate, limit int) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		yieldAll(s.snapshot(pred, limit), yield)
+	}
+}
+
+func (s *stripedSet) IterateCtx(ctx context.Context, pred Predicate, limit int) <-chan Item {
+	return sendAll(ctx, s.snapshot(pred, limit))
+}
+
+// Deprecated: the sending goroutine leaks unless the channel is drained, use All or IterateCtx
+func (s *stripedSet) IterateAll() <-chan Item {
+	return s.IterateCtx(context.Background(), PredicateAll, -1)
+}
+
+// Deprecated: the sending goroutine leaks unless the channel is drained, use Select or IterateCtx
+func (s *stripedSet) Iterate(pred Predicate, limit int) <-chan Item {
+	return s.IterateCtx(context.Background(), pred, limit)
+}
+
+func (s *stripedSet) UnionWith(other Set) int {
+	added := 0
+	for _, item := range other.Snapshot() {
+		if s.Add(item) {
+			added++
+		}
+	}
+	return added
+}
+
+func (s *stripedSet) IntersectWith(other Set) int {
+	keep := make(map[string]bool)
+	for _, item := range other.Snapshot() {
+		keep[item.Key()] = true
+	}
+	return s.RemoveIf(func(item Item) bool {
+		return !keep[item.Key()]
+	})
+}
+
+func (s *stripedSet) DifferenceWith(other Set) int {
+	if other.order() == s.order() {
+		return s.RemoveIf(PredicateAll)
+	}
+
+	removed := 0
+	for _, item := range other.Snapshot() {
+		if s.Remove(item) {
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *stripedSet) RetainIf(pred Predicate) int {
+	return s.RemoveIf(func(item Item) bool {
+		return !pred(item)
+	})
+}
+
+func (s *stripedSet) RemoveIf(pred Predicate) int {
+	removed := 0
+	for _, stripe := range s.stripes {
+		removed += stripe.RemoveIf(pred)
+	}
+	return removed
+}
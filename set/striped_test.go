@@ -0,0 +1,124 @@
+package set
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStripedSetBasics(t *testing.T) {
+	fmt.Println("TestStripedSetBasics")
+	s := NewStripedSet(3)
+	if stripes := len(s.(*stripedSet).stripes); stripes != 4 {
+		t.Errorf("Expected 3 stripes to be rounded up to 4, got %d", stripes)
+	}
+	if stripes := len(NewStripedSet(0).(*stripedSet).stripes); stripes != DefaultStripes {
+		t.Errorf("Expected %d stripes by default, got %d", DefaultStripes, stripes)
+	}
+
+	populateSet(s, 1, 100)
+	assertSetSize(t, s, 100)
+	assertSetContains(t, s, 1, 100)
+	assertOperation(t, "add duplicate", s.Add(testItem{50}), false)
+	assertOperation(t, "remove 50", s.Remove(testItem{50}), true)
+	assertOperation(t, "contains 50", s.Contains(testItem{50}), false)
+	if item, found := s.Get(testItem{51}); !found || item.Key() != "51" {
+		t.Errorf("Expected to get item 51 back")
+	}
+	assertOperation(t, "limited select", len(s.Snapshot()) == 99 && countItems(s.Select(testPredicate, 10)) == 10, true)
+	s.Empty()
+	assertSetSize(t, s, 0)
+}
+
+func countItems(seq func(func(Item) bool)) int {
+	n := 0
+	for range seq {
+		n++
+	}
+	return n
+}
+
+func TestStripedSetOperations(t *testing.T) {
+	fmt.Println("TestStripedSetOperations")
+	s := NewStripedSet(8)
+	populateSet(s, 1, 20)
+	assertOperation(t, "equal to a set", Equal(s, getPopulatedSet(1, 20)), true)
+	assertOperation(t, "subset of itself", Subset(s, s), true)
+	x, _ := Intersection(s, getPopulatedSet(15, 30))
+	assertSetSize(t, x, 6)
+
+	assertOperation(t, "union with adds 10", s.UnionWith(getPopulatedSet(11, 30)) == 10, true)
+	assertOperation(t, "intersect with removes 10", s.IntersectWith(getPopulatedSet(11, 40)) == 10, true)
+	assertOperation(t, "difference with removes 5", s.DifferenceWith(getPopulatedSet(11, 15)) == 5, true)
+	assertOperation(t, "remove odd items removes 7", s.RemoveIf(testPredicate) == 7, true)
+	assertSetSize(t, s, 8)
+	assertSetContainsItems(t, s, []int{16, 18, 20, 22, 24, 26, 28, 30})
+
+	other := getTestSet()
+	assertOperation(t, "set union with striped set", other.UnionWith(s) == 8, true)
+	assertOperation(t, "difference with self empties it", s.DifferenceWith(s) == 8, true)
+}
+
+func TestStripedSetConcurrent(t *testing.T) {
+	fmt.Println("TestStripedSetConcurrent")
+	testConcurrentBinaryOperations(t, NewStripedSet(4), getPopulatedSet(25, 75))
+	s := NewStripedSet(16)
+	stress(t, func(worker, i int) {
+		item := testItem{worker*stressIterations + i}
+		s.Add(item)
+		s.Contains(item)
+		if i%100 == 0 {
+			s.Size()
+			s.Snapshot()
+		}
+		s.Remove(item)
+	})
+	assertSetSize(t, s, 0)
+}
+
+// benchmarkParallel runs a mix of 1 Add and Remove to every 8 Contains from every goroutine
+func benchmarkParallel(b *testing.B, s Set) {
+	populateSet(s, 0, 1<<12)
+	var worker int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		offset := int(atomic.AddInt64(&worker, 1)) << 16
+		for i := 0; pb.Next(); i++ {
+			item := testItem{offset + i&0xFFF}
+			switch i % 10 {
+			case 0:
+				s.Add(item)
+			case 1:
+				s.Remove(item)
+			default:
+				s.Contains(testItem{i & 0xFFF})
+			}
+		}
+	})
+}
+
+func BenchmarkParallelSet(b *testing.B) {
+	benchmarkParallel(b, NewSet())
+}
+
+func BenchmarkParallelStripedSet(b *testing.B) {
+	benchmarkParallel(b, NewStripedSet(DefaultStripes))
+}
+
+func BenchmarkParallelAddSet(b *testing.B) {
+	benchmarkParallelAdd(b, NewSet())
+}
+
+func BenchmarkParallelAddStripedSet(b *testing.B) {
+	benchmarkParallelAdd(b, NewStripedSet(DefaultStripes))
+}
+
+func benchmarkParallelAdd(b *testing.B, s Set) {
+	var worker int64
+	b.RunParallel(func(pb *testing.PB) {
+		offset := int(atomic.AddInt64(&worker, 1)) << 24
+		for i := 0; pb.Next(); i++ {
+			s.Add(testItem{offset + i})
+		}
+	})
+}